@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"io/fs"
 	"os"
 
 	"lox/internal/core"
@@ -9,17 +12,38 @@ import (
 )
 
 func main() {
-	core.RunFile("/Users/qianhangjian/interpreter/test/fib.lox")
-	return
-
-	if len(os.Args) > 2 {
-		logrus.Errorln("invalid args, usage: ")
+	root := flag.String("fs", "", "give scripts read and write access to the files below `dir`")
+	flag.Parse()
+	var opts []core.Option
+	if *root != "" {
+		opts = append(opts, core.WithFS(core.DirFS(*root)))
+	}
+	if flag.NArg() > 1 {
+		logrus.Errorln("invalid args, usage: lox [-fs dir] [script]")
 		os.Exit(64)
-	} else if len(os.Args) == 2 {
+	} else if flag.NArg() == 1 {
 		// run file
-		core.RunFile("/Users/qianhangjian/interpreter/test/token.lox")
+		if err := core.RunFile(flag.Arg(0), opts...); err != nil {
+			logrus.Errorln(err)
+			os.Exit(exitCode(err))
+		}
 	} else {
 		// run prompt
-		core.RunPrompt()
+		core.RunPrompt(opts...)
+	}
+}
+
+// exitCode follows sysexits: unreadable script, invalid source or a failure
+// while running.
+func exitCode(err error) int {
+	var pathErr *fs.PathError
+	var scanErrs core.ScanErrs
+	var parseErr core.ParseErr
+	switch {
+	case errors.As(err, &pathErr):
+		return 66
+	case errors.As(err, &scanErrs), errors.As(err, &parseErr):
+		return 65
 	}
+	return 70
 }
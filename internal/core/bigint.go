@@ -0,0 +1,167 @@
+package core
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+// maxExactInt is the largest magnitude below which every integer is a
+// float64.
+const maxExactInt = 1 << 53
+
+// BigInt is an integer too large for a float64 to hold exactly, written as a
+// literal or read by json.parse. Scripts see it as a number: it compares
+// exactly with other numbers and adding, subtracting or multiplying integers
+// stays exact. Division or a fraction falls back to float64 arithmetic.
+type BigInt struct {
+	n *big.Int
+}
+
+func (b *BigInt) String() string {
+	return b.n.String()
+}
+
+func (b *BigInt) neg() *BigInt {
+	return &BigInt{n: new(big.Int).Neg(b.n)}
+}
+
+// bigIntTag keys BigInts, and the floats equal to them, in maps and sets by
+// their value.
+type bigIntTag struct{}
+
+// parseBigInt returns the decimal integer text as a BigInt when a float64
+// can't hold it exactly.
+func parseBigInt(text string) (*BigInt, bool) {
+	if strings.ContainsAny(text, ".eE") {
+		return nil, false
+	}
+	n, ok := new(big.Int).SetString(text, 10)
+	if !ok || n.CmpAbs(big.NewInt(maxExactInt)) <= 0 {
+		return nil, false
+	}
+	return &BigInt{n: n}, true
+}
+
+// normalizeInt returns n as a float64 when that holds it exactly.
+func normalizeInt(n *big.Int) interface{} {
+	if n.CmpAbs(big.NewInt(maxExactInt)) <= 0 {
+		return float64(n.Int64())
+	}
+	return &BigInt{n: n}
+}
+
+// toFloat is the float64 nearest to the number v.
+func toFloat(v interface{}) float64 {
+	if b, ok := v.(*BigInt); ok {
+		f, _ := new(big.Float).SetInt(b.n).Float64()
+		return f
+	}
+	return v.(float64)
+}
+
+// exactInt returns the integer v holds, if it holds one.
+func exactInt(v interface{}) (*big.Int, bool) {
+	switch v := v.(type) {
+	case *BigInt:
+		return v.n, true
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			n, _ := big.NewFloat(v).Int(nil)
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+// bigCompare compares a and b exactly when one is a BigInt and the other a
+// number other than NaN.
+func bigCompare(a, b interface{}) (int, bool) {
+	_, abig := a.(*BigInt)
+	_, bbig := b.(*BigInt)
+	if !abig && !bbig {
+		return 0, false
+	}
+	x, ok := exactFloat(a)
+	if !ok {
+		return 0, false
+	}
+	y, ok := exactFloat(b)
+	if !ok {
+		return 0, false
+	}
+	return x.Cmp(y), true
+}
+
+func exactFloat(v interface{}) (*big.Float, bool) {
+	switch v := v.(type) {
+	case *BigInt:
+		return new(big.Float).SetInt(v.n), true
+	case float64:
+		if !math.IsNaN(v) {
+			return big.NewFloat(v), true
+		}
+	}
+	return nil, false
+}
+
+// bigOp applies an arithmetic or comparison operator when one operand is a
+// BigInt and the other a number.
+func bigOp(operator Token, left, right interface{}) (interface{}, bool) {
+	if !isNumber(left) || !isNumber(right) {
+		return nil, false
+	}
+	switch operator.kind {
+	case GREATER, GREATER_EQUAL, LESS, LESS_EQUAL:
+		c, ok := bigCompare(left, right)
+		if !ok {
+			// NaN is unordered
+			return false, true
+		}
+		switch operator.kind {
+		case GREATER:
+			return c > 0, true
+		case GREATER_EQUAL:
+			return c >= 0, true
+		case LESS:
+			return c < 0, true
+		}
+		return c <= 0, true
+	case PLUS, MINUS, STAR:
+		x, xok := exactInt(left)
+		y, yok := exactInt(right)
+		if !xok || !yok {
+			break
+		}
+		n := new(big.Int)
+		switch operator.kind {
+		case PLUS:
+			n.Add(x, y)
+		case MINUS:
+			n.Sub(x, y)
+		case STAR:
+			n.Mul(x, y)
+		}
+		return normalizeInt(n), true
+	}
+	ln, rn := toFloat(left), toFloat(right)
+	switch operator.kind {
+	case PLUS:
+		return ln + rn, true
+	case MINUS:
+		return ln - rn, true
+	case STAR:
+		return ln * rn, true
+	case SLASH:
+		return ln / rn, true
+	}
+	return nil, false
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case float64, *BigInt:
+		return true
+	}
+	return false
+}
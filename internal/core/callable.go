@@ -2,45 +2,106 @@ package core
 
 import (
 	"fmt"
-	"time"
+	"unicode/utf8"
 )
 
 type Callalble interface {
+	// arity is the number of arguments expected, or variadic
 	arity() int
 	call(i *Interpreter, args []interface{}) interface{}
 }
 
-type clockFunc struct{}
+const variadic = -1
 
-func (c clockFunc) arity() int {
-	return 0
+// nativeFunc adapts a Go function, it is used for built-ins and for methods
+// bound to a receiver.
+type nativeFunc struct {
+	name string
+	argc int
+	fn   func(i *Interpreter, args []interface{}) interface{}
 }
 
-func (c clockFunc) call(i *Interpreter, args []interface{}) interface{} {
-	return float64(time.Now().UTC().Second())
+func (n *nativeFunc) arity() int {
+	return n.argc
 }
 
-type printlnFunc struct{}
+func (n *nativeFunc) call(i *Interpreter, args []interface{}) interface{} {
+	return n.fn(i, args)
+}
+
+func (n *nativeFunc) String() string {
+	return "<native fn " + n.name + ">"
+}
 
-func (p printlnFunc) arity() int {
-	return 1
+// clockFunc returns the seconds since the interpreter started. The system
+// clock reading is monotonic, so it suits measuring elapsed time.
+func clockFunc(i *Interpreter, args []interface{}) interface{} {
+	return i.loop.clock.Now().Sub(i.epoch).Seconds()
 }
 
-func (p printlnFunc) call(i *Interpreter, args []interface{}) interface{} {
+func printlnFunc(i *Interpreter, args []interface{}) interface{} {
 	fmt.Println(args)
 	return nil
 }
 
+// lenFunc counts strings in code points, not bytes.
+func lenFunc(i *Interpreter, args []interface{}) interface{} {
+	switch v := args[0].(type) {
+	case string:
+		return float64(utf8.RuneCountInString(v))
+	case *List:
+		return float64(len(v.elems))
+	case *Map:
+		return float64(len(v.entries))
+	case *Tuple:
+		return float64(len(v.elems))
+	case *Set:
+		return float64(len(v.elems))
+	case Range:
+		return float64(v.len())
+	}
+	panic(nativeErr("len: unsupported value " + repr(args[0])))
+}
+
 func (f FuncStmt) arity() int {
 	return len(f.params)
 }
 
+func (f FuncStmt) String() string {
+	if f.async {
+		return "<async fn " + f.name.lexeme + ">"
+	}
+	return "<fn " + f.name.lexeme + ">"
+}
+
 func (f FuncStmt) call(i *Interpreter, args []interface{}) interface{} {
+	if f.async {
+		return i.runAsync(&nativeFunc{name: f.name.lexeme, argc: variadic, fn: f.run}, args)
+	}
+	return f.run(i, args)
+}
+
+// run executes the body of f.
+func (f FuncStmt) run(i *Interpreter, args []interface{}) (result interface{}) {
 	env := NewEnv(f.closure)
 	for idx := range f.params {
 		env.define(f.params[idx].lexeme, args[idx])
 	}
 
+	// deferred calls run on return as well as on runtime errors
+	i.pushDefers()
+	defer i.runDefers()
+	// `expr?` returns from inside an expression by panicking a ReturnErr
+	defer func() {
+		if r := recover(); r != nil {
+			ret, ok := r.(ReturnErr)
+			if !ok {
+				panic(r)
+			}
+			result = ret.value
+		}
+	}()
+
 	err := i.evaluateBlockStmt(BlockStmt{f.body}, env)
 	if v, ok := err.(ReturnErr); ok {
 		return v.value
@@ -0,0 +1,237 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	coSuspended = "suspended"
+	coRunning   = "running"
+	coDead      = "dead"
+)
+
+// Coroutine is a stackful coroutine. Its function runs on a goroutine of
+// its own with a forked interpreter, control is handed back and forth over
+// channels so only one side runs at a time, and yield may be called from
+// any depth of nested calls.
+type Coroutine struct {
+	fn      Callalble
+	status  string
+	started bool
+	// closing is set while close unwinds the coroutine.
+	closing bool
+	// async marks the fibers of async functions, which suspend on await.
+	async bool
+	in    chan interface{}
+	out   chan coTransfer
+}
+
+// coCancel is sent instead of a value to unwind a suspended coroutine, the
+// pending yield or await panics with it.
+type coCancel struct{}
+
+// coTransfer is what the coroutine hands back to its resumer: a yielded
+// value, or the final result or failure once done.
+type coTransfer struct {
+	value interface{}
+	done  bool
+	err   interface{}
+}
+
+func newCoroutine(i *Interpreter, args []interface{}) interface{} {
+	fn, ok := args[0].(Callalble)
+	if !ok {
+		panic(nativeErr("coroutine: expect a function, got " + repr(args[0])))
+	}
+	return makeCoroutine(fn)
+}
+
+func makeCoroutine(fn Callalble) *Coroutine {
+	return &Coroutine{
+		fn:     fn,
+		status: coSuspended,
+		in:     make(chan interface{}),
+		out:    make(chan coTransfer),
+	}
+}
+
+func (c *Coroutine) String() string {
+	return fmt.Sprintf("<coroutine %s>", c.status)
+}
+
+func (c *Coroutine) get(name Token) interface{} {
+	switch name.lexeme {
+	case "status":
+		return c.status
+	case "resume":
+		return &nativeFunc{name: "resume", argc: variadic, fn: c.resume}
+	case "close":
+		return &nativeFunc{name: "close", argc: 0, fn: c.close}
+	}
+	panic(NewRuntimeErr(name, "coroutine has no property '%s'", name.lexeme))
+}
+
+// resume runs the coroutine until it yields or returns. The arguments of the
+// first resume are passed to the function, later ones become the result of
+// the pending yield. Errors raised inside the coroutine kill it and are
+// raised again in the resumer.
+func (c *Coroutine) resume(i *Interpreter, args []interface{}) interface{} {
+	switch c.status {
+	case coDead:
+		panic(nativeErr("cannot resume dead coroutine"))
+	case coRunning:
+		panic(nativeErr("cannot resume running coroutine"))
+	}
+
+	if !c.started {
+		if c.fn.arity() != variadic && c.fn.arity() != len(args) {
+			panic(nativeErr(fmt.Sprintf("args num not match, require %d, got %d", c.fn.arity(), len(args))))
+		}
+		c.started = true
+		c.status = coRunning
+		child := i.fork()
+		child.co = c
+		i.coroutines.add(c)
+		go c.run(child, args)
+	} else {
+		if len(args) > 1 {
+			panic(nativeErr(fmt.Sprintf("resume takes at most 1 argument, got %d", len(args))))
+		}
+		c.status = coRunning
+		c.in <- optionalArg(args)
+	}
+
+	out := <-c.out
+	if out.done {
+		c.status = coDead
+	} else {
+		c.status = coSuspended
+	}
+	if out.err != nil {
+		panic(out.err)
+	}
+	return out.value
+}
+
+// close kills a suspended coroutine. Its pending yield unwinds the stack,
+// running deferred calls, so the goroutine behind it exits. Closing a dead
+// coroutine does nothing.
+func (c *Coroutine) close(i *Interpreter, args []interface{}) interface{} {
+	switch c.status {
+	case coDead:
+		return nil
+	case coRunning:
+		panic(nativeErr("cannot close running coroutine"))
+	}
+	if !c.started {
+		c.status = coDead
+		return nil
+	}
+
+	c.closing = true
+	c.status = coRunning
+	c.in <- coCancel{}
+	out := <-c.out
+	c.status = coDead
+	if out.err != nil {
+		panic(out.err)
+	}
+	return nil
+}
+
+func (c *Coroutine) run(i *Interpreter, args []interface{}) {
+	var result coTransfer
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(coCancel); ok {
+				result = coTransfer{done: true}
+			} else {
+				result = coTransfer{done: true, err: r}
+			}
+		}
+		i.coroutines.remove(c)
+		c.out <- result
+	}()
+	result = coTransfer{done: true, value: c.fn.call(i, args)}
+}
+
+// yield suspends the running coroutine, handing its argument to the
+// resumer, and returns the value passed to the next resume.
+func yield(i *Interpreter, args []interface{}) interface{} {
+	if i.co == nil {
+		panic(nativeErr("yield outside of a coroutine"))
+	}
+	if i.co.async {
+		panic(nativeErr("yield inside an async function, use await"))
+	}
+	if len(args) > 1 {
+		panic(nativeErr(fmt.Sprintf("yield takes at most 1 argument, got %d", len(args))))
+	}
+	return i.co.suspend(optionalArg(args))
+}
+
+// suspend hands v to the resumer and waits to be resumed, or unwinds when
+// the coroutine is closed meanwhile.
+func (c *Coroutine) suspend(v interface{}) interface{} {
+	if c.closing {
+		panic(nativeErr("cannot suspend a closing coroutine"))
+	}
+	c.out <- coTransfer{value: v}
+	in := <-c.in
+	if _, ok := in.(coCancel); ok {
+		panic(in)
+	}
+	return in
+}
+
+// coroutineSet holds the coroutines of an interpreter that started and
+// haven't finished, so the ones a script abandons can be closed when it
+// ends.
+type coroutineSet struct {
+	mu   sync.Mutex
+	live map[*Coroutine]bool
+}
+
+func newCoroutineSet() *coroutineSet {
+	return &coroutineSet{live: make(map[*Coroutine]bool)}
+}
+
+func (s *coroutineSet) add(c *Coroutine) {
+	s.mu.Lock()
+	s.live[c] = true
+	s.mu.Unlock()
+}
+
+func (s *coroutineSet) remove(c *Coroutine) {
+	s.mu.Lock()
+	delete(s.live, c)
+	s.mu.Unlock()
+}
+
+// closeAll closes the suspended coroutines. Errors raised while they unwind
+// are dropped, the script is over.
+func (s *coroutineSet) closeAll(i *Interpreter) {
+	s.mu.Lock()
+	var suspended []*Coroutine
+	for c := range s.live {
+		if c.status == coSuspended {
+			suspended = append(suspended, c)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range suspended {
+		func() {
+			defer func() { recover() }()
+			c.close(i, nil)
+		}()
+	}
+}
+
+func optionalArg(args []interface{}) interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	return args[0]
+}
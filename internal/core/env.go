@@ -1,11 +1,12 @@
 package core
 
-import (
-	"fmt"
-)
+import "sync"
 
+// Env is safe for concurrent use: tasks started with spawn share the
+// environments their functions closed over.
 type Env struct {
 	enclosing *Env
+	mu        sync.RWMutex
 	values    map[string]interface{}
 }
 
@@ -17,38 +18,52 @@ func NewEnv(enclosing *Env) *Env {
 }
 
 func (e *Env) assign(t Token, v interface{}) {
+	e.mu.Lock()
 	if _, ok := e.values[t.lexeme]; ok {
 		e.values[t.lexeme] = v
+		e.mu.Unlock()
 		return
 	}
+	e.mu.Unlock()
 
 	if e.enclosing != nil {
 		e.enclosing.assign(t, v)
 		return
 	}
-	panic(fmt.Sprintf("assign, map key not exist: %s", t.lexeme))
+	panic(NewRuntimeErr(t, "undefined variable '%s'", t.lexeme))
 }
 
 func (e *Env) define(k string, v interface{}) {
+	e.mu.Lock()
 	e.values[k] = v
+	e.mu.Unlock()
 }
 
 func (e *Env) get(t Token) interface{} {
-	if v, ok := e.values[t.lexeme]; ok {
+	e.mu.RLock()
+	v, ok := e.values[t.lexeme]
+	e.mu.RUnlock()
+	if ok {
 		return v
 	}
 	if e.enclosing != nil {
 		return e.enclosing.get(t)
 	}
-	panic(fmt.Sprintf("get, map key not exist: %s", t.lexeme))
+	panic(NewRuntimeErr(t, "undefined variable '%s'", t.lexeme))
 }
 
 func (e *Env) getAt(distance int, name string) interface{} {
-	return e.ancestor(distance).values[name]
+	en := e.ancestor(distance)
+	en.mu.RLock()
+	defer en.mu.RUnlock()
+	return en.values[name]
 }
 
 func (e *Env) assignAt(distance int, name string, v interface{}) {
-	e.ancestor(distance).values[name] = v
+	en := e.ancestor(distance)
+	en.mu.Lock()
+	en.values[name] = v
+	en.mu.Unlock()
 }
 
 func (e *Env) ancestor(distance int) *Env {
@@ -1,6 +1,9 @@
 package core
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // not real error
 type ReturnErr struct {
@@ -10,3 +13,66 @@ type ReturnErr struct {
 func (r ReturnErr) Error() string {
 	return fmt.Sprintf("%+v", r.value)
 }
+
+// BreakErr is returned by a break statement up to the innermost loop or
+// switch, like ReturnErr it is not a real error.
+type BreakErr struct{}
+
+func (BreakErr) Error() string {
+	return "break"
+}
+
+// RuntimeErr aborts the script, it is raised with panic and reported by run.
+type RuntimeErr struct {
+	token Token
+	msg   string
+}
+
+func (r RuntimeErr) Error() string {
+	return fmt.Sprintf("%s at line %d", r.msg, r.token.line)
+}
+
+func NewRuntimeErr(t Token, format string, args ...interface{}) RuntimeErr {
+	return RuntimeErr{token: t, msg: fmt.Sprintf(format, args...)}
+}
+
+// ParseErr is a syntax error, or a variable misused in a way the resolver
+// catches. Both raise it with panic, doParse and resolveProgram return it.
+type ParseErr struct {
+	token Token
+	msg   string
+}
+
+func (p ParseErr) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", p.msg, p.token.line, p.token.pos.col)
+}
+
+func NewParseErr(t Token, format string, args ...interface{}) ParseErr {
+	return ParseErr{token: t, msg: fmt.Sprintf(format, args...)}
+}
+
+// nativeErr is raised by native functions, which know no source position.
+// evaluateCallExpr turns it into a RuntimeErr at the call site.
+type nativeErr string
+
+// ScanErr is a diagnostic reported while scanning the source.
+type ScanErr struct {
+	line int
+	col  int
+	msg  string
+}
+
+func (s ScanErr) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", s.msg, s.line, s.col)
+}
+
+// ScanErrs are the diagnostics of a source that failed to scan.
+type ScanErrs []error
+
+func (s ScanErrs) Error() string {
+	msgs := make([]string, len(s))
+	for idx, err := range s {
+		msgs[idx] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -1,5 +1,7 @@
 package core
 
+import "reflect"
+
 type Expr interface{}
 
 type BinaryExpr struct {
@@ -90,10 +92,125 @@ type LogicalExpr struct {
 	operator Token
 }
 
+// GetExpr is the property access `object.name`.
+type GetExpr struct {
+	object Expr
+	name   Token
+}
+
 type CallExpr struct {
 	callee Expr
 	paren  Token
 	args   []Expr
+	named  []NamedArg
+}
+
+// NamedArg is a `name: value` argument, which follows the positional ones.
+type NamedArg struct {
+	name  Token
+	value Expr
+}
+
+// TryExpr is `value?`, it unwraps Ok and Some and returns Err and None
+// from the enclosing function.
+type TryExpr struct {
+	value    Expr
+	question Token
+}
+
+// TupleExpr is `(a, b)`, `(a,)` or `()`.
+type TupleExpr struct {
+	paren Token
+	elems []Expr
+}
+
+// SetExpr is `object.name = value`.
+type SetExpr struct {
+	object Expr
+	name   Token
+	value  Expr
+}
+
+// RangeExpr is `left..right`, or `left..=right` when inclusive.
+type RangeExpr struct {
+	left     Expr
+	right    Expr
+	operator Token
+}
+
+type ListExpr struct {
+	bracket Token
+	elems   []Expr
+}
+
+// SetLiteralExpr is `#{a, b}`.
+type SetLiteralExpr struct {
+	brace Token
+	elems []Expr
+}
+
+type IndexExpr struct {
+	object  Expr
+	bracket Token
+	index   Expr
+}
+
+// SliceExpr is `object[start:end:step]`, any of the bounds may be nil.
+type SliceExpr struct {
+	object  Expr
+	bracket Token
+	start   Expr
+	end     Expr
+	step    Expr
+}
+
+type SetIndexExpr struct {
+	object  Expr
+	bracket Token
+	index   Expr
+	value   Expr
+}
+
+type MapExpr struct {
+	brace  Token
+	keys   []Expr
+	values []Expr
+}
+
+// ListCompExpr is `[elem for names in iterable if cond]`.
+type ListCompExpr struct {
+	bracket Token
+	elem    Expr
+	clause  CompClause
+}
+
+// MapCompExpr is `{key: value for names in iterable if cond}`.
+type MapCompExpr struct {
+	brace  Token
+	key    Expr
+	value  Expr
+	clause CompClause
+}
+
+// CompClause is the `for names in iterable if cond` part of a
+// comprehension, cond may be nil.
+type CompClause struct {
+	names    []Token
+	iterable Expr
+	cond     Expr
+}
+
+// SpawnExpr is `spawn call`, which runs the call on a goroutine of its own
+// and evaluates to a task.
+type SpawnExpr struct {
+	keyword Token
+	call    CallExpr
+}
+
+// AwaitExpr is `await value`.
+type AwaitExpr struct {
+	keyword Token
+	value   Expr
 }
 
 // deprecate
@@ -112,20 +229,52 @@ func evaluate(e Expr) interface{} {
 	return nil
 }
 
+// isTruthy follows Lox: nil and false are falsey, everything else is truthy.
+func isTruthy(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	return true
+}
+
+// isEqual is defined for any pair of values: values of different types are
+// never equal, sets are equal when they hold the same elements, lists, maps
+// and functions are equal only to themselves.
 func isEqual(a, b interface{}) bool {
-	if a == nil && b == nil {
-		return true
+	if a == nil || b == nil {
+		return a == nil && b == nil
 	}
-	if a == nil {
-		return false
+
+	switch a := a.(type) {
+	case *Tuple:
+		t, ok := b.(*Tuple)
+		return ok && elemsEqual(a.elems, t.elems)
+	case *Record:
+		r, ok := b.(*Record)
+		return ok && a.typ == r.typ && elemsEqual(a.values, r.values)
+	case *Result:
+		r, ok := b.(*Result)
+		return ok && a.ok == r.ok && isEqual(a.value, r.value)
+	case *Maybe:
+		o, ok := b.(*Maybe)
+		return ok && a.some == o.some && isEqual(a.value, o.value)
+	case *DateTime:
+		t, ok := b.(*DateTime)
+		return ok && a.t.Equal(t.t)
+	case *Set:
+		o, ok := b.(*Set)
+		return ok && len(a.keys) == len(o.keys) && subset(a, o)
+	}
+	if c, ok := bigCompare(a, b); ok {
+		return c == 0
 	}
 
-	switch a.(type) {
-	case float64:
-		// TODO: precition
-		return a.(float64) == b.(float64)
-	case string:
-		return a.(string) == b.(string)
+	ta := reflect.TypeOf(a)
+	if ta != reflect.TypeOf(b) || !ta.Comparable() {
+		return false
 	}
-	return false
+	return a == b
 }
@@ -0,0 +1,315 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSystem is the storage behind the fs module. Names are slash separated
+// and relative to the root of the file system, the module cleans them and
+// rejects names leaving the root before they get here.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	// WriteFile creates or truncates the file
+	WriteFile(name string, data []byte) error
+	// AppendFile creates the file when it doesn't exist
+	AppendFile(name string, data []byte) error
+	Stat(name string) (fs.FileInfo, error)
+	// ReadDir returns the entries sorted by name
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(name string) error
+	// Remove deletes a file or an empty directory
+	Remove(name string) error
+}
+
+// DirFS is the operating system's file tree below root. Symbolic links are
+// followed only while they stay below root, names leading out of it through a
+// link fail, and so do links pointing nowhere.
+func DirFS(root string) FileSystem {
+	return dirFS(root)
+}
+
+type dirFS string
+
+var errEscapes = errors.New("path escapes the root")
+
+// resolve returns where name is on disk, following the links along it. The
+// part of name that doesn't exist yet is appended as is.
+func (d dirFS) resolve(op, name string) (string, error) {
+	root, err := filepath.Abs(string(d))
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return "", err
+	}
+	resolved := root
+	parts := strings.Split(name, "/")
+	for idx, part := range parts {
+		next := filepath.Join(resolved, part)
+		info, err := os.Lstat(next)
+		if errors.Is(err, fs.ErrNotExist) {
+			return filepath.Join(append([]string{next}, parts[idx+1:]...)...), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if next, err = filepath.EvalSymlinks(next); err != nil {
+				return "", &fs.PathError{Op: op, Path: name, Err: errEscapes}
+			}
+		}
+		if rel, err := filepath.Rel(root, next); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", &fs.PathError{Op: op, Path: name, Err: errEscapes}
+		}
+		resolved = next
+	}
+	return resolved, nil
+}
+
+func (d dirFS) ReadFile(name string) ([]byte, error) {
+	p, err := d.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (d dirFS) WriteFile(name string, data []byte) error {
+	p, err := d.resolve("open", name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+func (d dirFS) AppendFile(name string, data []byte) error {
+	p, err := d.resolve("open", name)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := d.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+func (d dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := d.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(p)
+}
+
+func (d dirFS) MkdirAll(name string) error {
+	p, err := d.resolve("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, 0755)
+}
+
+// Remove deletes a link itself rather than what it points to, so only the
+// directory holding name is resolved.
+func (d dirFS) Remove(name string) error {
+	dir, err := d.resolve("remove", path.Dir(name))
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return os.Remove(dir)
+	}
+	return os.Remove(filepath.Join(dir, path.Base(name)))
+}
+
+// MemFS is a FileSystem held in memory, for tests and sandboxes without
+// disk access. It is safe for concurrent use.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: make(map[string][]byte),
+		dirs:  map[string]bool{".": true},
+	}
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[name]
+	if !ok {
+		return nil, m.missing("open", name)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkWritable("open", name); err != nil {
+		return err
+	}
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemFS) AppendFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkWritable("open", name); err != nil {
+		return err
+	}
+	m.files[name] = append(m.files[name], data...)
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dirs[name] {
+		return memInfo{name: path.Base(name), dir: true}, nil
+	}
+	if data, ok := m.files[name]; ok {
+		return memInfo{name: path.Base(name), size: int64(len(data))}, nil
+	}
+	return nil, m.missing("stat", name)
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirs[name] {
+		return nil, m.missing("open", name)
+	}
+	var entries []fs.DirEntry
+	for dir := range m.dirs {
+		if dir != "." && path.Dir(dir) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: path.Base(dir), dir: true}))
+		}
+	}
+	for file, data := range m.files {
+		if path.Dir(file) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: path.Base(file), size: int64(len(data))}))
+		}
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Name() < entries[b].Name()
+	})
+	return entries, nil
+}
+
+func (m *MemFS) MkdirAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for dir := name; !m.dirs[dir]; dir = path.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: fs.ErrExist}
+		}
+	}
+	for dir := name; !m.dirs[dir]; dir = path.Dir(dir) {
+		m.dirs[dir] = true
+	}
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; ok {
+		delete(m.files, name)
+		return nil
+	}
+	if !m.dirs[name] {
+		return m.missing("remove", name)
+	}
+	for p := range m.files {
+		if path.Dir(p) == name {
+			return &fs.PathError{Op: "remove", Path: name, Err: errDirNotEmpty}
+		}
+	}
+	for p := range m.dirs {
+		if p != "." && path.Dir(p) == name {
+			return &fs.PathError{Op: "remove", Path: name, Err: errDirNotEmpty}
+		}
+	}
+	if name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	delete(m.dirs, name)
+	return nil
+}
+
+var errDirNotEmpty = errors.New("directory not empty")
+
+func (m *MemFS) missing(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// checkWritable fails when name is a directory or its parent is missing.
+func (m *MemFS) checkWritable(op, name string) error {
+	if m.dirs[name] {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	}
+	if !m.dirs[path.Dir(name)] {
+		return m.missing(op, name)
+	}
+	return nil
+}
+
+type memInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memInfo) Name() string {
+	return i.name
+}
+
+func (i memInfo) Size() int64 {
+	return i.size
+}
+
+func (i memInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (i memInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (i memInfo) IsDir() bool {
+	return i.dir
+}
+
+func (i memInfo) Sys() interface{} {
+	return nil
+}
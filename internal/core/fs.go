@@ -0,0 +1,318 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// newFSModule gives scripts the files of fsys. Paths are relative to its
+// root, those leaving the root are rejected. Without a file system every
+// function fails.
+func newFSModule(fsys FileSystem, loop *eventLoop) *Module {
+	m := NewModule("fs")
+	if fsys != nil {
+		fsys = blockingFS{fsys: fsys, loop: loop}
+	}
+	define := func(name string, argc int, fn func(fsys FileSystem, args []interface{}) interface{}) {
+		m.define(name, argc, func(i *Interpreter, args []interface{}) interface{} {
+			if fsys == nil {
+				panic(nativeErr("fs." + name + ": no file system configured"))
+			}
+			return fn(fsys, args)
+		})
+	}
+
+	define("read", 1, func(fsys FileSystem, args []interface{}) interface{} {
+		name := pathArg(args[0], "fs.read")
+		data, err := fsys.ReadFile(name)
+		checkFS(err, name, "fs.read")
+		return string(data)
+	})
+	define("write", 2, func(fsys FileSystem, args []interface{}) interface{} {
+		name := pathArg(args[0], "fs.write")
+		checkFS(fsys.WriteFile(name, []byte(stringArg(args[1], "fs.write"))), name, "fs.write")
+		return nil
+	})
+	define("append", 2, func(fsys FileSystem, args []interface{}) interface{} {
+		name := pathArg(args[0], "fs.append")
+		checkFS(fsys.AppendFile(name, []byte(stringArg(args[1], "fs.append"))), name, "fs.append")
+		return nil
+	})
+	define("exists", 1, func(fsys FileSystem, args []interface{}) interface{} {
+		name := pathArg(args[0], "fs.exists")
+		_, err := fsys.Stat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false
+		}
+		checkFS(err, name, "fs.exists")
+		return true
+	})
+	// list returns the sorted entry names of a directory, the root by default
+	define("list", variadic, func(fsys FileSystem, args []interface{}) interface{} {
+		checkArgc(args, 0, 1, "fs.list")
+		name := "."
+		if len(args) == 1 {
+			name = pathArg(args[0], "fs.list")
+		}
+		entries, err := fsys.ReadDir(name)
+		checkFS(err, name, "fs.list")
+		names := make([]interface{}, len(entries))
+		for idx, e := range entries {
+			names[idx] = e.Name()
+		}
+		return NewList(names)
+	})
+	// mkdir creates missing parents too
+	define("mkdir", 1, func(fsys FileSystem, args []interface{}) interface{} {
+		name := pathArg(args[0], "fs.mkdir")
+		checkFS(fsys.MkdirAll(name), name, "fs.mkdir")
+		return nil
+	})
+	define("remove", 1, func(fsys FileSystem, args []interface{}) interface{} {
+		name := pathArg(args[0], "fs.remove")
+		checkFS(fsys.Remove(name), name, "fs.remove")
+		return nil
+	})
+	define("lines", 1, func(fsys FileSystem, args []interface{}) interface{} {
+		name := pathArg(args[0], "fs.lines")
+		data, err := fsys.ReadFile(name)
+		checkFS(err, name, "fs.lines")
+		return NewList(splitLines(string(data)))
+	})
+	// open returns a file handle, mode is "r" (the default), "w" or "a"
+	define("open", variadic, func(fsys FileSystem, args []interface{}) interface{} {
+		checkArgc(args, 1, 2, "fs.open")
+		name := pathArg(args[0], "fs.open")
+		mode := "r"
+		if len(args) == 2 {
+			mode = stringArg(args[1], "fs.open")
+		}
+		return openFile(fsys, name, mode)
+	})
+	return m
+}
+
+// blockingFS lets go of the interpreter lock while fsys works, so spawned
+// tasks run meanwhile and their file operations overlap.
+type blockingFS struct {
+	fsys FileSystem
+	loop *eventLoop
+}
+
+func (b blockingFS) ReadFile(name string) (data []byte, err error) {
+	b.loop.blocking(func() {
+		data, err = b.fsys.ReadFile(name)
+	})
+	return data, err
+}
+
+func (b blockingFS) WriteFile(name string, data []byte) (err error) {
+	b.loop.blocking(func() {
+		err = b.fsys.WriteFile(name, data)
+	})
+	return err
+}
+
+func (b blockingFS) AppendFile(name string, data []byte) (err error) {
+	b.loop.blocking(func() {
+		err = b.fsys.AppendFile(name, data)
+	})
+	return err
+}
+
+func (b blockingFS) Stat(name string) (info fs.FileInfo, err error) {
+	b.loop.blocking(func() {
+		info, err = b.fsys.Stat(name)
+	})
+	return info, err
+}
+
+func (b blockingFS) ReadDir(name string) (entries []fs.DirEntry, err error) {
+	b.loop.blocking(func() {
+		entries, err = b.fsys.ReadDir(name)
+	})
+	return entries, err
+}
+
+func (b blockingFS) MkdirAll(name string) (err error) {
+	b.loop.blocking(func() {
+		err = b.fsys.MkdirAll(name)
+	})
+	return err
+}
+
+func (b blockingFS) Remove(name string) (err error) {
+	b.loop.blocking(func() {
+		err = b.fsys.Remove(name)
+	})
+	return err
+}
+
+// File is a handle returned by fs.open. Reading handles load the whole file
+// when opened, writing handles write through on every call.
+type File struct {
+	fsys   FileSystem
+	name   string
+	mode   string
+	data   string
+	pos    int
+	closed bool
+}
+
+func openFile(fsys FileSystem, name, mode string) *File {
+	f := &File{fsys: fsys, name: name, mode: mode}
+	switch mode {
+	case "r":
+		data, err := fsys.ReadFile(name)
+		checkFS(err, name, "fs.open")
+		f.data = string(data)
+	case "w":
+		checkFS(fsys.WriteFile(name, nil), name, "fs.open")
+	case "a":
+		checkFS(fsys.AppendFile(name, nil), name, "fs.open")
+	default:
+		panic(nativeErr(fmt.Sprintf("fs.open: invalid mode %s, expect \"r\", \"w\" or \"a\"", repr(mode))))
+	}
+	return f
+}
+
+func (f *File) String() string {
+	return fmt.Sprintf("<file %s (%s)>", f.name, f.mode)
+}
+
+func (f *File) get(name Token) interface{} {
+	switch name.lexeme {
+	case "name":
+		return f.name
+	case "closed":
+		return f.closed
+	case "read":
+		return &nativeFunc{name: "read", argc: 0, fn: f.read}
+	case "readLine":
+		return &nativeFunc{name: "readLine", argc: 0, fn: f.readLine}
+	case "lines":
+		return &nativeFunc{name: "lines", argc: 0, fn: f.readLines}
+	case "write":
+		return &nativeFunc{name: "write", argc: 1, fn: f.write}
+	case "close":
+		return &nativeFunc{name: "close", argc: 0, fn: f.close}
+	}
+	panic(NewRuntimeErr(name, "file has no property '%s'", name.lexeme))
+}
+
+// iterator yields the remaining lines.
+func (f *File) iterator() iterator {
+	f.checkReadable("iterate")
+	return iteratorFunc(func() (interface{}, bool) {
+		if f.closed {
+			return nil, false
+		}
+		line := f.nextLine()
+		return line, line != nil
+	})
+}
+
+// read returns the rest of the file.
+func (f *File) read(i *Interpreter, args []interface{}) interface{} {
+	f.checkReadable("read")
+	rest := f.data[f.pos:]
+	f.pos = len(f.data)
+	return rest
+}
+
+// readLine returns the next line without its line break, or nil at the end.
+func (f *File) readLine(i *Interpreter, args []interface{}) interface{} {
+	f.checkReadable("readLine")
+	return f.nextLine()
+}
+
+func (f *File) readLines(i *Interpreter, args []interface{}) interface{} {
+	f.checkReadable("lines")
+	rest := splitLines(f.data[f.pos:])
+	f.pos = len(f.data)
+	return NewList(rest)
+}
+
+func (f *File) nextLine() interface{} {
+	if f.pos >= len(f.data) {
+		return nil
+	}
+	line := f.data[f.pos:]
+	if idx := strings.IndexByte(line, '\n'); idx >= 0 {
+		line = line[:idx]
+		f.pos++
+	}
+	f.pos += len(line)
+	return strings.TrimSuffix(line, "\r")
+}
+
+func (f *File) write(i *Interpreter, args []interface{}) interface{} {
+	f.checkOpen("write")
+	if f.mode == "r" {
+		panic(nativeErr("write: " + f.name + " is opened for reading"))
+	}
+	checkFS(f.fsys.AppendFile(f.name, []byte(stringArg(args[0], "write"))), f.name, "write")
+	return nil
+}
+
+// close may be called more than once.
+func (f *File) close(i *Interpreter, args []interface{}) interface{} {
+	f.closed = true
+	f.data = ""
+	f.pos = 0
+	return nil
+}
+
+func (f *File) checkOpen(fn string) {
+	if f.closed {
+		panic(nativeErr(fn + ": " + f.name + " is closed"))
+	}
+}
+
+func (f *File) checkReadable(fn string) {
+	f.checkOpen(fn)
+	if f.mode != "r" {
+		panic(nativeErr(fn + ": " + f.name + " is opened for writing"))
+	}
+}
+
+// pathArg cleans a slash separated path and checks it stays below the root.
+func pathArg(v interface{}, fn string) string {
+	name := path.Clean(stringArg(v, fn))
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		panic(nativeErr(fmt.Sprintf("%s: path %s escapes the root", fn, repr(v))))
+	}
+	return name
+}
+
+// checkFS reports err as an error of the script. Path errors name the path
+// the script used rather than where the file system keeps it.
+func checkFS(err error, name, fn string) {
+	if err == nil {
+		return
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = &fs.PathError{Op: pathErr.Op, Path: name, Err: pathErr.Err}
+	}
+	panic(nativeErr(fn + ": " + err.Error()))
+}
+
+// splitLines splits text into lines without their \n or \r\n. A final line
+// break doesn't start another line.
+func splitLines(text string) []interface{} {
+	var lines []interface{}
+	for text != "" {
+		line := text
+		if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+			line, text = text[:idx], text[idx+1:]
+		} else {
+			text = ""
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\r"))
+	}
+	return lines
+}
@@ -1,26 +1,125 @@
 package core
 
-import "fmt"
+import "time"
 
 type Interpreter struct {
 	globals *Env
-	locals  map[Expr]int
+	// locals maps each resolved variable occurrence, identified by its
+	// name token, to the number of scopes between its use and definition.
+	locals map[Token]int
+	// defers holds one frame of deferred calls per running function.
+	defers [][]deferredCall
+	// co is the coroutine this interpreter runs, if any.
+	co *Coroutine
+	// coroutines are the started, unfinished coroutines of the program
+	coroutines *coroutineSet
+	// tasks are the spawned, unfinished tasks of the program
+	tasks  *taskSet
+	loop   *eventLoop
+	random *randSource
+	// epoch is when the interpreter started, clock counts from it
+	epoch time.Time
+	// ticks counts loop iterations, see checkpoint
+	ticks int
+	// files backs the fs module, scripts have no file access without it
+	files FileSystem
 }
 
-func NewInterpreter() *Interpreter {
+// Option configures an Interpreter.
+type Option func(*Interpreter)
+
+// WithClock sets the time source of timers, clock and the time module.
+func WithClock(c Clock) Option {
+	return func(i *Interpreter) {
+		i.loop.clock = c
+	}
+}
+
+// WithRandSeed seeds the random module, so runs are reproducible.
+func WithRandSeed(seed int64) Option {
+	return func(i *Interpreter) {
+		i.random.seed(seed)
+	}
+}
+
+// WithFS gives the fs module access to fsys, use DirFS to expose a
+// directory or NewMemFS for a sandbox.
+func WithFS(fsys FileSystem) Option {
+	return func(i *Interpreter) {
+		i.files = fsys
+	}
+}
+
+type deferredCall struct {
+	fn    Callalble
+	args  []interface{}
+	token Token
+}
+
+func NewInterpreter(opts ...Option) *Interpreter {
 	i := &Interpreter{
-		globals: NewEnv(nil),
-		locals:  make(map[Expr]int),
+		globals:    NewEnv(nil),
+		locals:     make(map[Token]int),
+		loop:       newEventLoop(systemClock{}),
+		coroutines: newCoroutineSet(),
+		tasks:      newTaskSet(),
+		random:     newRandSource(time.Now().UnixNano()),
 	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	i.epoch = i.loop.clock.Now()
 
-	i.globals.define("clock", clockFunc{})
-	i.globals.define("println", printlnFunc{})
+	i.globals.define("clock", &nativeFunc{name: "clock", argc: 0, fn: clockFunc})
+	i.globals.define("println", &nativeFunc{name: "println", argc: 1, fn: printlnFunc})
+	i.globals.define("len", &nativeFunc{name: "len", argc: 1, fn: lenFunc})
+	i.globals.define("help", &nativeFunc{name: "help", argc: 1, fn: helpFunc})
+	i.globals.define("arity", &nativeFunc{name: "arity", argc: 1, fn: arityFunc})
+	i.globals.define("name", &nativeFunc{name: "name", argc: 1, fn: nameFunc})
+	i.globals.define("params", &nativeFunc{name: "params", argc: 1, fn: paramsFunc})
+	i.globals.define("type", &nativeFunc{name: "type", argc: 1, fn: typeFunc})
+	i.globals.define("set", &nativeFunc{name: "set", argc: variadic, fn: newSet})
+	i.globals.define("Ok", &nativeFunc{name: "Ok", argc: 1, fn: newOk})
+	i.globals.define("Err", &nativeFunc{name: "Err", argc: 1, fn: newErr})
+	i.globals.define("Some", &nativeFunc{name: "Some", argc: 1, fn: newSome})
+	i.globals.define("None", none)
+	i.globals.define("try", &nativeFunc{name: "try", argc: variadic, fn: tryFunc})
+	i.globals.define("get", &nativeFunc{name: "get", argc: 2, fn: getFunc})
+	i.globals.define("parseNumber", &nativeFunc{name: "parseNumber", argc: 1, fn: parseNumberFunc})
+	i.globals.define("math", newMathModule())
+	i.globals.define("random", newRandomModule(i.random))
+	i.globals.define("time", newTimeModule())
+	i.globals.define("fs", newFSModule(i.files, i.loop))
+	i.globals.define("json", newJSONModule())
+	i.globals.define("coroutine", &nativeFunc{name: "coroutine", argc: 1, fn: newCoroutine})
+	i.globals.define("yield", &nativeFunc{name: "yield", argc: variadic, fn: yield})
+	i.globals.define("channel", &nativeFunc{name: "channel", argc: 1, fn: newChannel})
+	i.globals.define("setTimeout", &nativeFunc{name: "setTimeout", argc: 2, fn: setTimeout})
+	i.globals.define("setInterval", &nativeFunc{name: "setInterval", argc: 2, fn: setInterval})
+	i.globals.define("clearTimeout", &nativeFunc{name: "clearTimeout", argc: 1, fn: clearTimer})
+	i.globals.define("clearInterval", &nativeFunc{name: "clearInterval", argc: 1, fn: clearTimer})
+	i.globals.define("sleep", &nativeFunc{name: "sleep", argc: 1, fn: sleep})
 
 	return i
 }
 
-func (i *Interpreter) resolve(ex Expr, depth int) {
-	i.locals[ex] = depth
+// fork returns an interpreter sharing the program of i but with call state
+// of its own, to run code on another goroutine.
+func (i *Interpreter) fork() *Interpreter {
+	return &Interpreter{
+		globals:    i.globals,
+		locals:     i.locals,
+		loop:       i.loop,
+		random:     i.random,
+		epoch:      i.epoch,
+		coroutines: i.coroutines,
+		tasks:      i.tasks,
+		files:      i.files,
+	}
+}
+
+func (i *Interpreter) resolve(name Token, depth int) {
+	i.locals[name] = depth
 }
 
 func (i *Interpreter) interpret(s interface{}) interface{} {
@@ -33,7 +132,7 @@ func (i *Interpreter) interpret(s interface{}) interface{} {
 	case UnaryExpr:
 		return i.evaluateUnaryExpr(v)
 	case GroupExpr:
-		return v.evaluate()
+		return i.interpret(v.expression)
 	case LiteralExpr:
 		return v.evaluate()
 	case VarExpr:
@@ -42,6 +141,36 @@ func (i *Interpreter) interpret(s interface{}) interface{} {
 		return i.evaluateLogicalStmt(v)
 	case CallExpr:
 		return i.evaluateCallExpr(v)
+	case TupleExpr:
+		return i.evaluateTupleExpr(v)
+	case SetLiteralExpr:
+		return i.evaluateSetLiteralExpr(v)
+	case TryExpr:
+		return i.evaluateTryExpr(v)
+	case SetExpr:
+		return i.evaluateSetExpr(v)
+	case GetExpr:
+		return i.evaluateGetExpr(v)
+	case SpawnExpr:
+		return i.evaluateSpawnExpr(v)
+	case AwaitExpr:
+		return i.evaluateAwaitExpr(v)
+	case RangeExpr:
+		return i.evaluateRangeExpr(v)
+	case ListExpr:
+		return i.evaluateListExpr(v)
+	case IndexExpr:
+		return i.evaluateIndexExpr(v)
+	case SliceExpr:
+		return i.evaluateSliceExpr(v)
+	case SetIndexExpr:
+		return i.evaluateSetIndexExpr(v)
+	case MapExpr:
+		return i.evaluateMapExpr(v)
+	case ListCompExpr:
+		return i.evaluateListCompExpr(v)
+	case MapCompExpr:
+		return i.evaluateMapCompExpr(v)
 	case VarStmt:
 		return i.evaluateVarStmt(v)
 	case ExprStmt:
@@ -52,10 +181,26 @@ func (i *Interpreter) interpret(s interface{}) interface{} {
 		return i.evaluateIfStmt(v)
 	case WhileStmt:
 		return i.evaluateWhileStmt(v)
+	case DoWhileStmt:
+		return i.evaluateDoWhileStmt(v)
+	case SelectStmt:
+		return i.evaluateSelectStmt(v)
+	case SwitchStmt:
+		return i.evaluateSwitchStmt(v)
+	case BreakStmt:
+		return BreakErr{}
+	case ForInStmt:
+		return i.evaluateForInStmt(v)
 	case FuncStmt:
 		return i.evaluateFuncStmt(v)
+	case RecordStmt:
+		return i.evaluateRecordStmt(v)
 	case ReturnStmt:
 		return i.evaluateReturnStmt(v)
+	case DeferStmt:
+		return i.evaluateDeferStmt(v)
+	case AssertStmt:
+		return i.evaluateAssertStmt(v)
 	}
 	return nil
 }
@@ -63,16 +208,23 @@ func (i *Interpreter) interpret(s interface{}) interface{} {
 func (i *Interpreter) evaluateUnaryExpr(u UnaryExpr) interface{} {
 	switch u.operator.kind {
 	case MINUS:
-		return -1 * i.interpret(u.right).(float64)
+		right := i.interpret(u.right)
+		switch n := right.(type) {
+		case float64:
+			return -n
+		case *BigInt:
+			return n.neg()
+		}
+		panic(NewRuntimeErr(u.operator, "operand of - must be a number, got %s", repr(right)))
 	case BANG:
-		return !i.interpret(u.right).(bool)
+		return !isTruthy(i.interpret(u.right))
 	}
 	return nil
 }
 
 func (i *Interpreter) evaluateAssignExpr(a AssignExpr) interface{} {
 	value := i.interpret(a.value)
-	if distance, ok := i.locals[a]; ok {
+	if distance, ok := i.locals[a.name]; ok {
 		i.globals.assignAt(distance, a.name.lexeme, value)
 	} else {
 		i.globals.assign(a.name, value)
@@ -83,45 +235,74 @@ func (i *Interpreter) evaluateAssignExpr(a AssignExpr) interface{} {
 func (i *Interpreter) evaluateBinaryExpr(b BinaryExpr) interface{} {
 	left := i.interpret(b.left)
 	right := i.interpret(b.right)
+	return i.binaryOp(b.operator, left, right)
+}
 
-	switch b.operator.kind {
-	case MINUS:
-		return left.(float64) - right.(float64)
-	case STAR:
-		return left.(float64) * right.(float64)
-	case SLASH:
-		return left.(float64) / right.(float64)
-	case PLUS:
-		switch left.(type) {
-		case float64:
-			return left.(float64) + right.(float64)
-		case string:
-			return left.(string) + right.(string)
-		}
+func (i *Interpreter) binaryOp(operator Token, left, right interface{}) interface{} {
+	switch operator.kind {
 	case BANG_EQUAL:
 		return !isEqual(left, right)
 	case EQUAL_EQUAL:
 		return isEqual(left, right)
-	case GREATER:
-		return left.(float64) > right.(float64)
-	case GREATER_EQUAL:
-		return left.(float64) >= right.(float64)
-	case LESS:
-		return left.(float64) < right.(float64)
-	case LESS_EQUAL:
-		return left.(float64) <= right.(float64)
 	}
 
-	// unreachable
-	return nil
+	ln, lok := left.(float64)
+	rn, rok := right.(float64)
+	if lok && rok {
+		switch operator.kind {
+		case MINUS:
+			return ln - rn
+		case STAR:
+			return ln * rn
+		case SLASH:
+			return ln / rn
+		case PLUS:
+			return ln + rn
+		case GREATER:
+			return ln > rn
+		case GREATER_EQUAL:
+			return ln >= rn
+		case LESS:
+			return ln < rn
+		case LESS_EQUAL:
+			return ln <= rn
+		}
+	}
+
+	if v, ok := bigOp(operator, left, right); ok {
+		return v
+	}
+
+	ls, lok := left.(string)
+	rs, rok := right.(string)
+	if lok && rok {
+		switch operator.kind {
+		case PLUS:
+			return ls + rs
+		case GREATER:
+			return ls > rs
+		case GREATER_EQUAL:
+			return ls >= rs
+		case LESS:
+			return ls < rs
+		case LESS_EQUAL:
+			return ls <= rs
+		}
+	}
+
+	switch operator.kind {
+	case PLUS, GREATER, GREATER_EQUAL, LESS, LESS_EQUAL:
+		panic(NewRuntimeErr(operator, "operands of %s must be two numbers or two strings, got %s and %s", operator.lexeme, repr(left), repr(right)))
+	}
+	panic(NewRuntimeErr(operator, "operands of %s must be numbers, got %s and %s", operator.lexeme, repr(left), repr(right)))
 }
 
 func (i *Interpreter) evaluateVarExpr(v VarExpr) interface{} {
-	return i.lookUpVar(v.name, v)
+	return i.lookUpVar(v.name)
 }
 
-func (i *Interpreter) lookUpVar(name Token, ex Expr) interface{} {
-	if distance, ok := i.locals[ex]; ok {
+func (i *Interpreter) lookUpVar(name Token) interface{} {
+	if distance, ok := i.locals[name]; ok {
 		return i.globals.getAt(distance, name.lexeme)
 	} else {
 		return i.globals.get(name)
@@ -145,28 +326,21 @@ func (i *Interpreter) evaluateExprStmt(v ExprStmt) interface{} {
 func (i *Interpreter) evaluateBlockStmt(v BlockStmt, e *Env) interface{} {
 	previousEnv := i.globals
 	i.globals = e
-	var (
-		err      ReturnErr
-		returnOK bool
-	)
+	// restore the environment even when a runtime error unwinds the block
+	defer func() {
+		i.globals = previousEnv
+	}()
 	for _, stmt := range v.stmts {
-		t := i.interpret(stmt)
-		if t != nil {
-			if err, returnOK = t.(ReturnErr); returnOK {
-				break
-			}
+		switch t := i.interpret(stmt).(type) {
+		case ReturnErr, BreakErr:
+			return t
 		}
 	}
-	i.globals = previousEnv
-	if returnOK {
-		return err
-	}
 	return nil
 }
 
 func (i *Interpreter) evaluateIfStmt(v IfStmt) interface{} {
-	// TODO: support more condition check, eg: string, float...
-	if i.interpret(v.condition).(bool) {
+	if isTruthy(i.interpret(v.condition)) {
 		return i.interpret(v.thenBranch)
 	} else if v.elseBranch != nil {
 		return i.interpret(v.elseBranch)
@@ -174,46 +348,411 @@ func (i *Interpreter) evaluateIfStmt(v IfStmt) interface{} {
 	return nil
 }
 
+// evaluateLogicalStmt returns the operand that decides the result rather
+// than a bool, so `name or "default"` yields name when it is set.
 func (i *Interpreter) evaluateLogicalStmt(v LogicalExpr) interface{} {
-	left := i.interpret(v.left).(bool)
+	left := i.interpret(v.left)
 	if v.operator.kind == OR {
-		if left {
-			return true
+		if isTruthy(left) {
+			return left
 		}
-	} else if !left {
-		return false
+	} else if !isTruthy(left) {
+		return left
 	}
-	return i.interpret(v.right).(bool)
+	return i.interpret(v.right)
 }
 
 func (i *Interpreter) evaluateWhileStmt(v WhileStmt) interface{} {
-	for i.interpret(v.condition).(bool) {
-		i.interpret(v.body)
+	for isTruthy(i.interpret(v.condition)) {
+		i.checkpoint()
+		switch t := i.interpret(v.body).(type) {
+		case ReturnErr:
+			return t
+		case BreakErr:
+			return nil
+		}
 	}
 	return nil
 }
 
+func (i *Interpreter) evaluateDoWhileStmt(v DoWhileStmt) interface{} {
+	for {
+		i.checkpoint()
+		switch t := i.interpret(v.body).(type) {
+		case ReturnErr:
+			return t
+		case BreakErr:
+			return nil
+		}
+		if !isTruthy(i.interpret(v.condition)) {
+			return nil
+		}
+	}
+}
+
+func (i *Interpreter) evaluateSwitchStmt(v SwitchStmt) interface{} {
+	subject := i.interpret(v.subject)
+	matched := -1
+	for idx := 0; idx < len(v.cases) && matched < 0; idx++ {
+		for _, value := range v.cases[idx].values {
+			if isEqual(subject, i.interpret(value)) {
+				matched = idx
+				break
+			}
+		}
+	}
+	if matched < 0 {
+		for idx, c := range v.cases {
+			if len(c.values) == 0 {
+				matched = idx
+			}
+		}
+	}
+	if matched < 0 {
+		return nil
+	}
+
+	for idx := matched; idx < len(v.cases); idx++ {
+		switch t := i.evaluateBlockStmt(BlockStmt{stmts: v.cases[idx].body}, NewEnv(i.globals)).(type) {
+		case ReturnErr:
+			return t
+		case BreakErr:
+			return nil
+		}
+		if !v.cases[idx].falls {
+			break
+		}
+	}
+	return nil
+}
+
+func (i *Interpreter) evaluateForInStmt(v ForInStmt) interface{} {
+	it := iterateNames(i.interpret(v.iterable), v.names)
+	for {
+		value, ok := it.next()
+		if !ok {
+			return nil
+		}
+		i.checkpoint()
+		// a fresh environment per iteration so closures capture the
+		// current element
+		env := NewEnv(i.globals)
+		bindNames(env, v.names, value)
+		switch t := i.evaluateBlockStmt(BlockStmt{stmts: []Stmt{v.body}}, env).(type) {
+		case ReturnErr:
+			return t
+		case BreakErr:
+			return nil
+		}
+	}
+}
+
+func (i *Interpreter) evaluateRangeExpr(v RangeExpr) interface{} {
+	start, sok := i.interpret(v.left).(float64)
+	end, eok := i.interpret(v.right).(float64)
+	if !sok || !eok {
+		panic(NewRuntimeErr(v.operator, "range bounds must be numbers"))
+	}
+	r := Range{
+		start:     start,
+		end:       end,
+		inclusive: v.operator.kind == DOT_DOT_EQUAL,
+	}
+	if _, ok := r.count(); !ok {
+		panic(NewRuntimeErr(v.operator, "range %v has too many elements", r))
+	}
+	return r
+}
+
+func (i *Interpreter) evaluateListExpr(v ListExpr) interface{} {
+	elems := make([]interface{}, 0, len(v.elems))
+	for _, e := range v.elems {
+		elems = append(elems, i.interpret(e))
+	}
+	return NewList(elems)
+}
+
+func (i *Interpreter) evaluateMapExpr(v MapExpr) interface{} {
+	m := NewMap()
+	for idx := range v.keys {
+		m.set(i.interpret(v.keys[idx]), i.interpret(v.values[idx]), v.brace)
+	}
+	return m
+}
+
+func (i *Interpreter) evaluateListCompExpr(v ListCompExpr) interface{} {
+	elems := []interface{}{}
+	i.comprehend(v.clause, func() {
+		elems = append(elems, i.interpret(v.elem))
+	})
+	return NewList(elems)
+}
+
+func (i *Interpreter) evaluateMapCompExpr(v MapCompExpr) interface{} {
+	m := NewMap()
+	i.comprehend(v.clause, func() {
+		m.set(i.interpret(v.key), i.interpret(v.value), v.brace)
+	})
+	return m
+}
+
+// comprehend runs emit once for every element of the clause that passes
+// its condition, with the loop variables bound in a scope of their own.
+func (i *Interpreter) comprehend(clause CompClause, emit func()) {
+	it := iterateNames(i.interpret(clause.iterable), clause.names)
+	previous := i.globals
+	defer func() {
+		i.globals = previous
+	}()
+	for {
+		value, ok := it.next()
+		if !ok {
+			return
+		}
+		i.globals = NewEnv(previous)
+		bindNames(i.globals, clause.names, value)
+		if clause.cond == nil || isTruthy(i.interpret(clause.cond)) {
+			emit()
+		}
+	}
+}
+
+func (i *Interpreter) evaluateIndexExpr(v IndexExpr) interface{} {
+	object := i.interpret(v.object)
+	index := i.interpret(v.index)
+
+	switch o := object.(type) {
+	case *List:
+		return o.elems[toIndex(index, len(o.elems), v.bracket)]
+	case *Tuple:
+		return o.elems[toIndex(index, len(o.elems), v.bracket)]
+	case *Map:
+		value, _ := o.get(index, v.bracket)
+		return value
+	case string:
+		runes := []rune(o)
+		return string(runes[toIndex(index, len(runes), v.bracket)])
+	case Range:
+		return o.start + float64(toIndex(index, o.len(), v.bracket))
+	}
+	panic(NewRuntimeErr(v.bracket, "value %s is not indexable", repr(object)))
+}
+
+func (i *Interpreter) evaluateSliceExpr(v SliceExpr) interface{} {
+	object := i.interpret(v.object)
+	var bounds [3]interface{}
+	for idx, e := range []Expr{v.start, v.end, v.step} {
+		if e != nil {
+			bounds[idx] = i.interpret(e)
+		}
+	}
+
+	switch o := object.(type) {
+	case *List:
+		var elems []interface{}
+		for _, idx := range sliceIndexes(len(o.elems), bounds[0], bounds[1], bounds[2], v.bracket) {
+			elems = append(elems, o.elems[idx])
+		}
+		return NewList(elems)
+	case *Tuple:
+		var elems []interface{}
+		for _, idx := range sliceIndexes(len(o.elems), bounds[0], bounds[1], bounds[2], v.bracket) {
+			elems = append(elems, o.elems[idx])
+		}
+		return NewTuple(elems)
+	case string:
+		runes := []rune(o)
+		var sliced []rune
+		for _, idx := range sliceIndexes(len(runes), bounds[0], bounds[1], bounds[2], v.bracket) {
+			sliced = append(sliced, runes[idx])
+		}
+		return string(sliced)
+	}
+	panic(NewRuntimeErr(v.bracket, "value %s can not be sliced", repr(object)))
+}
+
+func (i *Interpreter) evaluateSetIndexExpr(v SetIndexExpr) interface{} {
+	object := i.interpret(v.object)
+	index := i.interpret(v.index)
+	value := i.interpret(v.value)
+
+	switch o := object.(type) {
+	case *List:
+		o.elems[toIndex(index, len(o.elems), v.bracket)] = value
+		return value
+	case *Map:
+		o.set(index, value, v.bracket)
+		return value
+	case *Tuple:
+		panic(NewRuntimeErr(v.bracket, "can't assign to an element of %s, tuples are immutable", repr(object)))
+	}
+	panic(NewRuntimeErr(v.bracket, "value %s does not support item assignment", repr(object)))
+}
+
 func (i *Interpreter) evaluateCallExpr(v CallExpr) interface{} {
+	fn, args := i.prepareCall(v)
+	return i.call(fn, args, v.paren)
+}
+
+// call invokes fn, reporting errors raised by native functions at t.
+func (i *Interpreter) call(fn Callalble, args []interface{}, t Token) interface{} {
+	if _, ok := fn.(*FuncStmt); !ok {
+		defer func() {
+			if r := recover(); r != nil {
+				if msg, ok := r.(nativeErr); ok {
+					panic(NewRuntimeErr(t, "%s", msg))
+				}
+				panic(r)
+			}
+		}()
+	}
+	return fn.call(i, args)
+}
+
+// prepareCall evaluates the callee and arguments of a call and checks them.
+func (i *Interpreter) prepareCall(v CallExpr) (Callalble, []interface{}) {
 	callee := i.interpret(v.callee)
 
 	var args []interface{}
 	for _, a := range v.args {
 		args = append(args, i.interpret(a))
 	}
+	if len(v.named) > 0 {
+		return i.keywordCall(callee, args, v), args
+	}
 	if fn, ok := callee.(Callalble); ok {
-		if fn.arity() != len(args) {
-			panic(fmt.Sprintf("args num not match, require %d, got %d, line %d", fn.arity(), len(args), v.paren.line))
+		if fn.arity() != variadic && fn.arity() != len(args) {
+			panic(NewRuntimeErr(v.paren, "args num not match, require %d, got %d", fn.arity(), len(args)))
 		}
-		return fn.call(i, args)
+		return fn, args
 	} else {
-		panic(fmt.Sprintf("invalid fun call at line %d", v.paren.line))
+		panic(NewRuntimeErr(v.paren, "value %s is not callable", repr(callee)))
+	}
+}
+
+// keywordCall binds the named arguments of v to callee, the result takes
+// the positional arguments.
+func (i *Interpreter) keywordCall(callee interface{}, args []interface{}, v CallExpr) Callalble {
+	fn, ok := callee.(keywordCallable)
+	if !ok {
+		panic(NewRuntimeErr(v.paren, "value %s does not take named arguments", repr(callee)))
+	}
+	kwargs := make([]keywordArg, len(v.named))
+	for idx, n := range v.named {
+		kwargs[idx] = keywordArg{name: n.name, value: i.interpret(n.value)}
+	}
+	return &nativeFunc{
+		name: funcName(fn),
+		argc: variadic,
+		fn: func(i *Interpreter, args []interface{}) interface{} {
+			return fn.callKeywords(i, args, kwargs)
+		},
+	}
+}
+
+// negatedOps spells out why a failed comparison failed, e.g. 55 != 56.
+var negatedOps = map[TokenKind]string{
+	EQUAL_EQUAL:   "!=",
+	BANG_EQUAL:    "==",
+	LESS:          ">=",
+	LESS_EQUAL:    ">",
+	GREATER:       "<=",
+	GREATER_EQUAL: "<",
+}
+
+func (i *Interpreter) evaluateAssertStmt(v AssertStmt) interface{} {
+	ex := v.expr
+	for {
+		group, ok := ex.(GroupExpr)
+		if !ok {
+			break
+		}
+		ex = group.expression
+	}
+
+	var detail string
+	if b, ok := ex.(BinaryExpr); ok && negatedOps[b.operator.kind] != "" {
+		left := i.interpret(b.left)
+		right := i.interpret(b.right)
+		if passed, _ := i.binaryOp(b.operator, left, right).(bool); passed {
+			return nil
+		}
+		detail = repr(left) + " " + negatedOps[b.operator.kind] + " " + repr(right)
+	} else if isTruthy(i.interpret(ex)) {
+		return nil
+	}
+
+	msg := "assert " + v.source + " failed"
+	if v.message != nil {
+		text := i.interpret(v.message)
+		if s, ok := text.(string); ok {
+			msg += ": " + s
+		} else {
+			msg += ": " + repr(text)
+		}
+	}
+	if detail != "" {
+		msg += ": " + detail
+	}
+	panic(RuntimeErr{token: v.keyword, msg: msg})
+}
+
+// getter is implemented by values with properties.
+type getter interface {
+	get(name Token) interface{}
+}
+
+func (i *Interpreter) evaluateGetExpr(v GetExpr) interface{} {
+	object := i.interpret(v.object)
+	if s, ok := object.(string); ok {
+		return stringMethod(s, v.name)
+	}
+	if g, ok := object.(getter); ok {
+		return g.get(v.name)
+	}
+	panic(NewRuntimeErr(v.name, "value %s has no property '%s'", repr(object), v.name.lexeme))
+}
+
+func (i *Interpreter) evaluateDeferStmt(v DeferStmt) interface{} {
+	fn, args := i.prepareCall(v.call)
+	frame := len(i.defers) - 1
+	i.defers[frame] = append(i.defers[frame], deferredCall{fn: fn, args: args, token: v.keyword})
+	return nil
+}
+
+// pushDefers opens the frame collecting the calls deferred by a function.
+func (i *Interpreter) pushDefers() {
+	i.defers = append(i.defers, nil)
+}
+
+// runDefers pops the current frame and runs its calls, most recent first.
+// A failing call doesn't stop the others, the last failure is raised once
+// all of them ran.
+func (i *Interpreter) runDefers() {
+	frame := i.defers[len(i.defers)-1]
+	i.defers = i.defers[:len(i.defers)-1]
+
+	var failure interface{}
+	for idx := len(frame) - 1; idx >= 0; idx-- {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					failure = r
+				}
+			}()
+			i.call(frame[idx].fn, frame[idx].args, frame[idx].token)
+		}()
+	}
+	if failure != nil {
+		panic(failure)
 	}
 }
 
 func (i *Interpreter) evaluateFuncStmt(v FuncStmt) interface{} {
 	v.closure = i.globals
+	// functions are shared by pointer so they compare by identity
 	fn := v
-	i.globals.define(fn.name.lexeme, fn)
+	i.globals.define(fn.name.lexeme, &fn)
 	return nil
 }
 
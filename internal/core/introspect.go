@@ -0,0 +1,121 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// toCallable is used by the built-ins below, which all take a function.
+func toCallable(v interface{}, fn string) Callalble {
+	c, ok := v.(Callalble)
+	if !ok {
+		panic(nativeErr(fmt.Sprintf("%s: expect a function, got %s", fn, repr(v))))
+	}
+	return c
+}
+
+func funcName(c Callalble) string {
+	switch c := c.(type) {
+	case *FuncStmt:
+		return c.name.lexeme
+	case *nativeFunc:
+		return c.name
+	case *RecordType:
+		return c.name
+	}
+	return fmt.Sprint(c)
+}
+
+// funcParams returns the parameter names of c, native functions have none.
+func funcParams(c Callalble) []string {
+	if r, ok := c.(*RecordType); ok {
+		return r.fields
+	}
+	fn, ok := c.(*FuncStmt)
+	if !ok {
+		return nil
+	}
+	names := make([]string, len(fn.params))
+	for idx, p := range fn.params {
+		names[idx] = p.lexeme
+	}
+	return names
+}
+
+// signature formats c as `name(a, b)`. Parameters of native functions are
+// shown as _, or ... when they are variadic.
+func signature(c Callalble) string {
+	params := funcParams(c)
+	switch c.(type) {
+	case *FuncStmt, *RecordType:
+	default:
+		if c.arity() == variadic {
+			params = []string{"..."}
+		} else {
+			params = make([]string, c.arity())
+			for idx := range params {
+				params[idx] = "_"
+			}
+		}
+	}
+	sig := funcName(c) + "(" + strings.Join(params, ", ") + ")"
+	if fn, ok := c.(*FuncStmt); ok && fn.async {
+		return "async " + sig
+	}
+	return sig
+}
+
+// helpFunc prints the signature and docstring of a function, or the
+// members of a module, and returns the printed text.
+func helpFunc(i *Interpreter, args []interface{}) interface{} {
+	var lines []string
+	if m, ok := args[0].(*Module); ok {
+		lines = append(lines, "module "+m.name)
+		for _, name := range m.names() {
+			if c, ok := m.members[name].(Callalble); ok {
+				lines = append(lines, "    "+strings.TrimPrefix(signature(c), m.name+"."))
+			} else {
+				lines = append(lines, "    "+name+" = "+repr(m.members[name]))
+			}
+		}
+	} else {
+		c := toCallable(args[0], "help")
+		doc := "no documentation"
+		if fn, ok := c.(*FuncStmt); ok && fn.doc != "" {
+			doc = fn.doc
+		}
+		lines = append(lines, signature(c))
+		for _, line := range strings.Split(strings.TrimSpace(doc), "\n") {
+			lines = append(lines, "    "+line)
+		}
+	}
+	text := strings.Join(lines, "\n")
+	fmt.Println(text)
+	return text
+}
+
+// arityFunc returns nil for variadic functions.
+func arityFunc(i *Interpreter, args []interface{}) interface{} {
+	n := toCallable(args[0], "arity").arity()
+	if n == variadic {
+		return nil
+	}
+	return float64(n)
+}
+
+func nameFunc(i *Interpreter, args []interface{}) interface{} {
+	return funcName(toCallable(args[0], "name"))
+}
+
+func paramsFunc(i *Interpreter, args []interface{}) interface{} {
+	names := funcParams(toCallable(args[0], "params"))
+	elems := make([]interface{}, len(names))
+	for idx, name := range names {
+		elems[idx] = name
+	}
+	return NewList(elems)
+}
+
+func typeFunc(i *Interpreter, args []interface{}) interface{} {
+	return typeName(args[0])
+}
@@ -0,0 +1,224 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const maxIndent = 10
+
+func newJSONModule() *Module {
+	m := NewModule("json")
+	m.define("parse", 1, func(i *Interpreter, args []interface{}) interface{} {
+		return parseJSON(stringArg(args[0], "json.parse"))
+	})
+	// stringify is compact unless indent, a count of spaces or a string,
+	// is given. Like JavaScript's JSON.stringify it indents by at most
+	// maxIndent spaces or characters.
+	m.define("stringify", variadic, func(i *Interpreter, args []interface{}) interface{} {
+		checkArgc(args, 1, 2, "json.stringify")
+		e := jsonEncoder{visiting: make(map[interface{}]bool)}
+		if len(args) == 2 {
+			switch indent := args[1].(type) {
+			case nil:
+			case string:
+				if len([]rune(indent)) > maxIndent {
+					indent = string([]rune(indent)[:maxIndent])
+				}
+				e.indent = indent
+			default:
+				if n, ok := indent.(float64); ok && n > maxIndent {
+					indent = float64(maxIndent)
+				}
+				e.indent = strings.Repeat(" ", countArg(indent, "json.stringify"))
+			}
+		}
+		e.encode(args[0], 0)
+		return e.b.String()
+	})
+	return m
+}
+
+// parseJSON decodes text token by token, so objects keep the order of their
+// keys.
+func parseJSON(text string) interface{} {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	v := decodeJSON(dec, nextJSONToken(dec))
+	if _, err := dec.Token(); err != io.EOF {
+		panic(nativeErr(fmt.Sprintf("json.parse: unexpected data after the value at offset %d", dec.InputOffset())))
+	}
+	return v
+}
+
+func nextJSONToken(dec *json.Decoder) json.Token {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			panic(nativeErr(fmt.Sprintf("json.parse: %s at offset %d", err, syntaxErr.Offset)))
+		}
+		panic(nativeErr("json.parse: " + err.Error()))
+	}
+	return tok
+}
+
+func decodeJSON(dec *json.Decoder, tok json.Token) interface{} {
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' {
+			elems := []interface{}{}
+			for dec.More() {
+				elems = append(elems, decodeJSON(dec, nextJSONToken(dec)))
+			}
+			nextJSONToken(dec)
+			return NewList(elems)
+		}
+		m := NewMap()
+		for dec.More() {
+			key := nextJSONToken(dec)
+			m.set(key, decodeJSON(dec, nextJSONToken(dec)), Token{})
+		}
+		nextJSONToken(dec)
+		return m
+	case json.Number:
+		return decodeNumber(string(tok))
+	}
+	// strings, bools and null
+	return tok
+}
+
+// decodeNumber keeps integers exact, those too large for a number become a
+// BigInt.
+func decodeNumber(text string) interface{} {
+	if n, ok := parseBigInt(text); ok {
+		return n
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		panic(nativeErr("json.parse: number " + text + " is out of range"))
+	}
+	return f
+}
+
+type jsonEncoder struct {
+	b      bytes.Buffer
+	indent string
+	// visiting holds the containers being encoded, meeting one again means
+	// it contains itself
+	visiting map[interface{}]bool
+}
+
+func (e *jsonEncoder) encode(v interface{}, depth int) {
+	switch v := v.(type) {
+	case nil:
+		e.b.WriteString("null")
+	case bool:
+		e.b.WriteString(strconv.FormatBool(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			panic(nativeErr(fmt.Sprintf("json.stringify: %v is not a valid JSON number", v)))
+		}
+		e.writeJSON(v)
+	case *BigInt:
+		e.b.WriteString(v.n.String())
+	case string:
+		e.writeJSON(v)
+	case *List:
+		e.enter(v)
+		e.array(v.elems, depth)
+		delete(e.visiting, v)
+	case *Tuple:
+		e.array(v.elems, depth)
+	case *Set:
+		e.enter(v)
+		e.array(v.elems, depth)
+		delete(e.visiting, v)
+	case *Map:
+		e.enter(v)
+		keys := make([]string, len(v.entries))
+		values := make([]interface{}, len(v.entries))
+		for idx, entry := range v.entries {
+			key, ok := entry.key.(string)
+			if !ok {
+				panic(nativeErr("json.stringify: object keys must be strings, got " + repr(entry.key)))
+			}
+			keys[idx], values[idx] = key, entry.value
+		}
+		e.object(keys, values, depth)
+		delete(e.visiting, v)
+	case *Record:
+		e.object(v.typ.fields, v.values, depth)
+	default:
+		panic(nativeErr(fmt.Sprintf("json.stringify: can't serialize %s %s", typeName(v), repr(v))))
+	}
+}
+
+// enter marks a mutable container as being encoded.
+func (e *jsonEncoder) enter(v interface{}) {
+	if e.visiting[v] {
+		panic(nativeErr(fmt.Sprintf("json.stringify: cycle through %s", typeName(v))))
+	}
+	e.visiting[v] = true
+}
+
+func (e *jsonEncoder) array(elems []interface{}, depth int) {
+	e.b.WriteByte('[')
+	for idx, elem := range elems {
+		if idx > 0 {
+			e.b.WriteByte(',')
+		}
+		e.newline(depth + 1)
+		e.encode(elem, depth+1)
+	}
+	if len(elems) > 0 {
+		e.newline(depth)
+	}
+	e.b.WriteByte(']')
+}
+
+func (e *jsonEncoder) object(keys []string, values []interface{}, depth int) {
+	e.b.WriteByte('{')
+	for idx, key := range keys {
+		if idx > 0 {
+			e.b.WriteByte(',')
+		}
+		e.newline(depth + 1)
+		e.writeJSON(key)
+		e.b.WriteByte(':')
+		if e.indent != "" {
+			e.b.WriteByte(' ')
+		}
+		e.encode(values[idx], depth+1)
+	}
+	if len(keys) > 0 {
+		e.newline(depth)
+	}
+	e.b.WriteByte('}')
+}
+
+func (e *jsonEncoder) newline(depth int) {
+	if e.indent != "" {
+		e.b.WriteByte('\n')
+		e.b.WriteString(strings.Repeat(e.indent, depth))
+	}
+}
+
+// writeJSON writes a string or number as encoding/json does, without its
+// escaping of HTML characters.
+func (e *jsonEncoder) writeJSON(v interface{}) {
+	enc := json.NewEncoder(&e.b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	// Encode ends the value with a newline
+	e.b.Truncate(e.b.Len() - 1)
+}
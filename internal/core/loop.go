@@ -0,0 +1,596 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the time source of the event loop. Hosts and tests can inject a
+// ManualClock to run timers deterministically without real waiting.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// ManualClock only moves when slept on, so waiting for a timer is instant.
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+}
+
+// eventLoop runs queued jobs and due timers one at a time. Async functions,
+// timer callbacks and promise continuations all run on it.
+type eventLoop struct {
+	// gil is held by whichever task runs Lox code, so spawned tasks take
+	// turns and lists, maps and sets are never changed by two at once. It
+	// is let go while a task blocks.
+	gil    sync.Mutex
+	mu     sync.Mutex
+	clock  Clock
+	queue  []func()
+	timers []*timer
+	nextID int
+	// waiting counts tasks awaited by async functions, their results are
+	// queued from other goroutines and signalled on wake
+	waiting int
+	wake    chan struct{}
+	// unhandled keeps rejected promises nobody awaited yet.
+	unhandled []*Promise
+	// stopped is closed once the script is over, see taskSet.finish
+	stopped chan struct{}
+	// tasks counts the running tasks, the main one included, and parked
+	// the ones waiting for another, see park. gen changes with either.
+	tasks      int
+	parked     int
+	gen        int
+	deadlocked chan struct{}
+}
+
+type timer struct {
+	id       int
+	due      time.Time
+	interval time.Duration
+	fn       func()
+}
+
+func newEventLoop(clock Clock) *eventLoop {
+	return &eventLoop{
+		clock:      clock,
+		wake:       make(chan struct{}, 1),
+		stopped:    make(chan struct{}),
+		tasks:      1,
+		deadlocked: make(chan struct{}),
+	}
+}
+
+func (l *eventLoop) stop() {
+	close(l.stopped)
+}
+
+// blocking runs fn, which waits for something other than Lox code,
+// without holding the interpreter lock so other tasks run meanwhile.
+func (l *eventLoop) blocking(fn func()) {
+	l.gil.Unlock()
+	defer l.gil.Lock()
+	fn()
+}
+
+// park waits for one of cases like reflect.Select, for a task waiting on
+// another: to receive from or send to a channel or for a task to finish.
+// It gives up with taskCancel once the script is over, and with a deadlock
+// error when every task is parked, as none of them can wake the others.
+func (l *eventLoop) park(cases []reflect.SelectCase) (chosen int, value reflect.Value, ok bool) {
+	n := len(cases)
+	for _, c := range cases {
+		if c.Dir == reflect.SelectDefault {
+			return reflect.Select(cases)
+		}
+	}
+	// a ready case doesn't wait, so it doesn't count as parked
+	chosen, value, ok = reflect.Select(append(cases[:n:n], reflect.SelectCase{Dir: reflect.SelectDefault}))
+	if chosen < n {
+		return chosen, value, ok
+	}
+
+	l.mu.Lock()
+	l.parked++
+	l.gen++
+	deadlocked := l.deadlocked
+	l.checkDeadlock()
+	l.mu.Unlock()
+
+	l.gil.Unlock()
+	defer l.gil.Lock()
+	defer func() {
+		l.mu.Lock()
+		l.parked--
+		l.gen++
+		l.mu.Unlock()
+	}()
+	chosen, value, ok = reflect.Select(append(cases[:n:n], recvCase(l.stopped), recvCase(deadlocked)))
+	switch chosen {
+	case n:
+		panic(taskCancel{})
+	case n + 1:
+		panic(nativeErr("deadlock: all tasks are blocked"))
+	}
+	return chosen, value, ok
+}
+
+func recvCase(ch interface{}) reflect.SelectCase {
+	return reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
+}
+
+func (l *eventLoop) taskStarted() {
+	l.mu.Lock()
+	l.tasks++
+	l.gen++
+	l.mu.Unlock()
+}
+
+func (l *eventLoop) taskEnded() {
+	l.mu.Lock()
+	l.tasks--
+	l.gen++
+	l.checkDeadlock()
+	l.mu.Unlock()
+}
+
+// deadlockChecks are the pauses after which every task must still be
+// parked, with nothing changed meanwhile, to be deadlocked. A task whose
+// channel operation just went through counts as parked until its goroutine
+// runs again.
+var deadlockChecks = []time.Duration{5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond}
+
+// checkDeadlock wakes the parked tasks with an error when all of them stay
+// parked. It is called with mu held.
+func (l *eventLoop) checkDeadlock() {
+	if l.parked == 0 || l.parked < l.tasks {
+		return
+	}
+	gen := l.gen
+	go func() {
+		for _, d := range deadlockChecks {
+			time.Sleep(d)
+			l.mu.Lock()
+			stuck := l.gen == gen
+			l.mu.Unlock()
+			if !stuck {
+				return
+			}
+		}
+		l.mu.Lock()
+		if l.gen == gen {
+			close(l.deadlocked)
+			l.deadlocked = make(chan struct{})
+		}
+		l.mu.Unlock()
+	}()
+}
+
+func (l *eventLoop) enqueue(job func()) {
+	l.mu.Lock()
+	l.queue = append(l.queue, job)
+	l.mu.Unlock()
+	l.signal()
+}
+
+// signal wakes a loop waiting for outside work, without blocking.
+func (l *eventLoop) signal() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// watch returns a promise settled from the loop once t finishes, so an
+// async function can await a task without holding up the loop.
+func (l *eventLoop) watch(t *Task) *Promise {
+	p := newPromise(l)
+	l.mu.Lock()
+	l.waiting++
+	l.mu.Unlock()
+	t.awaited = true
+	go func() {
+		<-t.done
+		l.mu.Lock()
+		l.waiting--
+		l.queue = append(l.queue, func() {
+			if t.err != nil {
+				p.reject(t.err)
+			} else {
+				p.resolve(t.value)
+			}
+		})
+		l.mu.Unlock()
+		l.signal()
+	}()
+	return p
+}
+
+// schedule runs fn after d, and every interval after that when interval is
+// positive. It returns the timer id.
+func (l *eventLoop) schedule(d, interval time.Duration, fn func()) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextID += 1
+	l.insert(&timer{id: l.nextID, due: l.clock.Now().Add(d), interval: interval, fn: fn})
+	return l.nextID
+}
+
+// insert keeps timers ordered by due time, timers due at the same time fire
+// in the order they were scheduled.
+func (l *eventLoop) insert(t *timer) {
+	idx := sort.Search(len(l.timers), func(n int) bool {
+		return l.timers[n].due.After(t.due)
+	})
+	l.timers = append(l.timers, nil)
+	copy(l.timers[idx+1:], l.timers[idx:])
+	l.timers[idx] = t
+}
+
+func (l *eventLoop) cancel(id int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for idx, t := range l.timers {
+		if t.id == id {
+			l.timers = append(l.timers[:idx], l.timers[idx+1:]...)
+			return
+		}
+	}
+}
+
+// run keeps going until no job is queued, no timer is pending and no
+// awaited task is running.
+func (l *eventLoop) run() {
+	for l.step() {
+	}
+}
+
+// step runs the next queued job, or waits for the next timer and queues its
+// callback. It reports false when there is nothing left to do.
+func (l *eventLoop) step() bool {
+	l.mu.Lock()
+	if len(l.queue) > 0 {
+		job := l.queue[0]
+		l.queue = l.queue[1:]
+		l.mu.Unlock()
+		job()
+		return true
+	}
+	waiting := l.waiting > 0
+	if len(l.timers) == 0 {
+		l.mu.Unlock()
+		if !waiting {
+			return false
+		}
+		// the awaited tasks may all be parked too
+		l.park([]reflect.SelectCase{recvCase(l.wake)})
+		return true
+	}
+	next := l.timers[0]
+	l.mu.Unlock()
+
+	d := next.due.Sub(l.clock.Now())
+	if _, ok := l.clock.(systemClock); ok && waiting {
+		// a task may finish before the timer is due
+		woken := false
+		l.blocking(func() {
+			select {
+			case <-l.wake:
+				woken = true
+			case <-time.After(d):
+			}
+		})
+		if woken {
+			return true
+		}
+	} else {
+		l.blocking(func() {
+			l.clock.Sleep(d)
+		})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// the timer may have been cancelled while sleeping
+	if len(l.timers) == 0 || l.timers[0] != next {
+		return true
+	}
+	l.timers = l.timers[1:]
+	if next.interval > 0 {
+		next.due = next.due.Add(next.interval)
+		l.insert(next)
+	}
+	l.queue = append(l.queue, next.fn)
+	return true
+}
+
+// runUntil drives the loop until p settles, for awaits outside of async
+// functions.
+func (l *eventLoop) runUntil(p *Promise) {
+	for !p.settled() {
+		if !l.step() {
+			panic(nativeErr("await on a promise that never settles"))
+		}
+	}
+}
+
+func (l *eventLoop) rejected(p *Promise) {
+	l.mu.Lock()
+	l.unhandled = append(l.unhandled, p)
+	l.mu.Unlock()
+}
+
+// checkUnhandled raises the first rejection no one awaited.
+func (l *eventLoop) checkUnhandled() {
+	for _, p := range l.unhandled {
+		p.mu.Lock()
+		handled := p.handled
+		p.mu.Unlock()
+		if !handled {
+			panic(unhandledErr(p.err))
+		}
+	}
+}
+
+// unhandledErr marks err as the failure of a promise no one awaited.
+func unhandledErr(err interface{}) interface{} {
+	switch err := err.(type) {
+	case RuntimeErr:
+		return NewRuntimeErr(err.token, "unhandled rejection: %s", err.msg)
+	case nativeErr:
+		return nativeErr("unhandled rejection: " + string(err))
+	}
+	return err
+}
+
+const (
+	promisePending = iota
+	promiseFulfilled
+	promiseRejected
+)
+
+// Promise is the eventual result of an async function or timer.
+type Promise struct {
+	mu        sync.Mutex
+	loop      *eventLoop
+	state     int
+	value     interface{}
+	err       interface{}
+	handled   bool
+	callbacks []func()
+}
+
+func newPromise(loop *eventLoop) *Promise {
+	return &Promise{loop: loop}
+}
+
+func (p *Promise) String() string {
+	return "<promise " + p.status() + ">"
+}
+
+func (p *Promise) status() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch p.state {
+	case promiseFulfilled:
+		return "fulfilled"
+	case promiseRejected:
+		return "rejected"
+	}
+	return "pending"
+}
+
+func (p *Promise) get(name Token) interface{} {
+	if name.lexeme == "status" {
+		return p.status()
+	}
+	panic(NewRuntimeErr(name, "promise has no property '%s'", name.lexeme))
+}
+
+// resolve fulfills p with v, or makes p follow v when v is a promise.
+func (p *Promise) resolve(v interface{}) {
+	if other, ok := v.(*Promise); ok {
+		other.then(func() {
+			other.mu.Lock()
+			value, err, state := other.value, other.err, other.state
+			other.handled = true
+			other.mu.Unlock()
+			if state == promiseRejected {
+				p.reject(err)
+			} else {
+				p.resolve(value)
+			}
+		})
+		return
+	}
+	p.settle(promiseFulfilled, v, nil)
+}
+
+func (p *Promise) reject(err interface{}) {
+	if p.settle(promiseRejected, nil, err) {
+		p.loop.rejected(p)
+	}
+}
+
+// settle reports false when p was settled already.
+func (p *Promise) settle(state int, value, err interface{}) bool {
+	p.mu.Lock()
+	if p.state != promisePending {
+		p.mu.Unlock()
+		return false
+	}
+	p.state, p.value, p.err = state, value, err
+	callbacks := p.callbacks
+	p.callbacks = nil
+	p.mu.Unlock()
+
+	for _, cb := range callbacks {
+		cb()
+	}
+	return true
+}
+
+// then runs cb once p settles, right away if it already has.
+func (p *Promise) then(cb func()) {
+	p.mu.Lock()
+	if p.state == promisePending {
+		p.callbacks = append(p.callbacks, cb)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	cb()
+}
+
+func (p *Promise) settled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state != promisePending
+}
+
+// result returns the value of a settled promise, or raises its error.
+func (p *Promise) result() interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handled = true
+	if p.state == promiseRejected {
+		panic(p.err)
+	}
+	return p.value
+}
+
+// runAsync starts fn as a fiber on the event loop. The fiber runs until it
+// awaits a pending promise and is resumed by a loop job once that settles.
+// The returned promise settles with the result of fn.
+func (i *Interpreter) runAsync(fn Callalble, args []interface{}) *Promise {
+	p := newPromise(i.loop)
+	co := makeCoroutine(fn)
+	co.async = true
+
+	var step func(args []interface{})
+	step = func(args []interface{}) {
+		var awaited interface{}
+		failed := func() (failed bool) {
+			defer func() {
+				if r := recover(); r != nil {
+					p.reject(r)
+					failed = true
+				}
+			}()
+			awaited = co.resume(i, args)
+			return false
+		}()
+
+		switch {
+		case failed:
+		case co.status == coDead:
+			p.resolve(awaited)
+		default:
+			awaited.(*Promise).then(func() {
+				i.loop.enqueue(func() {
+					step(nil)
+				})
+			})
+		}
+	}
+	i.loop.enqueue(func() {
+		step(args)
+	})
+	return p
+}
+
+// await returns the result of p. Inside an async function the fiber is
+// suspended until p settles, elsewhere the event loop runs until it does.
+func (i *Interpreter) await(p *Promise) interface{} {
+	if !p.settled() {
+		if i.co != nil && i.co.async {
+			i.co.suspend(p)
+		} else {
+			i.loop.runUntil(p)
+		}
+	}
+	return p.result()
+}
+
+func toDuration(v interface{}, fn string) time.Duration {
+	ms, ok := v.(float64)
+	if !ok || ms < 0 {
+		panic(nativeErr(fmt.Sprintf("%s: expect a delay in milliseconds, got %s", fn, repr(v))))
+	}
+	return durationOf(ms, time.Millisecond, fn)
+}
+
+// timerCallback checks the callback of a timer, which runs like an async
+// function: with call state of its own, and failing by rejecting its
+// promise rather than stopping the loop.
+func (i *Interpreter) timerCallback(v interface{}, name string) func() {
+	fn, ok := v.(Callalble)
+	if !ok || (fn.arity() != 0 && fn.arity() != variadic) {
+		panic(nativeErr(fmt.Sprintf("%s: expect a function without parameters, got %s", name, repr(v))))
+	}
+	return func() {
+		i.runAsync(fn, nil)
+	}
+}
+
+func setTimeout(i *Interpreter, args []interface{}) interface{} {
+	d := toDuration(args[1], "setTimeout")
+	return float64(i.loop.schedule(d, 0, i.timerCallback(args[0], "setTimeout")))
+}
+
+func setInterval(i *Interpreter, args []interface{}) interface{} {
+	d := toDuration(args[1], "setInterval")
+	if d <= 0 {
+		panic(nativeErr("setInterval: interval must be positive"))
+	}
+	return float64(i.loop.schedule(d, d, i.timerCallback(args[0], "setInterval")))
+}
+
+func clearTimer(i *Interpreter, args []interface{}) interface{} {
+	if id, ok := args[0].(float64); ok {
+		i.loop.cancel(int(id))
+	}
+	return nil
+}
+
+// sleep returns a promise fulfilled after the given milliseconds.
+func sleep(i *Interpreter, args []interface{}) interface{} {
+	p := newPromise(i.loop)
+	i.loop.schedule(toDuration(args[0], "sleep"), 0, func() {
+		p.resolve(nil)
+	})
+	return p
+}
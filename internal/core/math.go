@@ -0,0 +1,125 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+func newMathModule() *Module {
+	m := NewModule("math")
+	m.members["pi"] = math.Pi
+	m.members["e"] = math.E
+	m.members["inf"] = math.Inf(1)
+	m.members["nan"] = math.NaN()
+
+	unary := map[string]func(float64) float64{
+		"floor": math.Floor,
+		"ceil":  math.Ceil,
+		"round": math.Round,
+		"abs":   math.Abs,
+		"sqrt":  math.Sqrt,
+		"exp":   math.Exp,
+		"log":   math.Log,
+		"log2":  math.Log2,
+		"log10": math.Log10,
+		"sin":   math.Sin,
+		"cos":   math.Cos,
+		"tan":   math.Tan,
+		"asin":  math.Asin,
+		"acos":  math.Acos,
+		"atan":  math.Atan,
+	}
+	for name, f := range unary {
+		name, f := name, f
+		m.define(name, 1, func(i *Interpreter, args []interface{}) interface{} {
+			return f(numberArg(args[0], "math."+name))
+		})
+	}
+
+	binary := map[string]func(float64, float64) float64{
+		"pow":   math.Pow,
+		"atan2": math.Atan2,
+		"hypot": math.Hypot,
+	}
+	for name, f := range binary {
+		name, f := name, f
+		m.define(name, 2, func(i *Interpreter, args []interface{}) interface{} {
+			return f(numberArg(args[0], "math."+name), numberArg(args[1], "math."+name))
+		})
+	}
+
+	m.define("min", variadic, func(i *Interpreter, args []interface{}) interface{} {
+		return extremum(args, "math.min", math.Min, -1)
+	})
+	m.define("max", variadic, func(i *Interpreter, args []interface{}) interface{} {
+		return extremum(args, "math.max", math.Max, 1)
+	})
+	m.define("clamp", 3, mathClamp)
+	m.define("isNaN", 1, func(i *Interpreter, args []interface{}) interface{} {
+		return math.IsNaN(numberArg(args[0], "math.isNaN"))
+	})
+	m.define("isInf", 1, func(i *Interpreter, args []interface{}) interface{} {
+		return math.IsInf(numberArg(args[0], "math.isInf"), 0)
+	})
+	return m
+}
+
+// extremum folds its arguments with pick. A single iterable argument is
+// unpacked, so both max(1, 2) and max([1, 2]) work. BigInts are compared
+// exactly, sign is 1 when pick keeps the greater number and -1 when it
+// keeps the smaller one.
+func extremum(args []interface{}, fn string, pick func(a, b float64) float64, sign int) interface{} {
+	if len(args) == 1 && !isNumber(args[0]) {
+		args = collect(args[0], fn)
+	}
+	if len(args) == 0 {
+		panic(nativeErr(fn + ": expect at least one number"))
+	}
+	result := args[0]
+	numberArg(result, fn)
+	for _, a := range args[1:] {
+		numberArg(a, fn)
+		if c, ok := bigCompare(result, a); ok {
+			if c*sign < 0 {
+				result = a
+			}
+			continue
+		}
+		result = pick(toFloat(result), toFloat(a))
+	}
+	return result
+}
+
+func mathClamp(i *Interpreter, args []interface{}) interface{} {
+	x := numberArg(args[0], "math.clamp")
+	lo := numberArg(args[1], "math.clamp")
+	hi := numberArg(args[2], "math.clamp")
+	if lo > hi {
+		panic(nativeErr(fmt.Sprintf("math.clamp: lower bound %v is above upper bound %v", lo, hi)))
+	}
+	return math.Max(lo, math.Min(hi, x))
+}
+
+// numberArg accepts a BigInt too, as the nearest float64.
+func numberArg(v interface{}, fn string) float64 {
+	if !isNumber(v) {
+		panic(nativeErr(fmt.Sprintf("%s: expect a number, got %s", fn, repr(v))))
+	}
+	return toFloat(v)
+}
+
+// collect returns the elements of the iterable v.
+func collect(v interface{}, fn string) []interface{} {
+	if _, ok := v.(iterable); !ok {
+		panic(nativeErr(fmt.Sprintf("%s: expect an iterable, got %s", fn, repr(v))))
+	}
+	var elems []interface{}
+	it := iterate(v, Token{})
+	for {
+		e, ok := it.next()
+		if !ok {
+			return elems
+		}
+		elems = append(elems, e)
+	}
+}
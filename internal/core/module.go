@@ -0,0 +1,40 @@
+package core
+
+import "sort"
+
+// Module is a namespace of built-ins such as math, its members are read
+// with `module.name`.
+type Module struct {
+	name    string
+	members map[string]interface{}
+}
+
+func NewModule(name string) *Module {
+	return &Module{name: name, members: make(map[string]interface{})}
+}
+
+func (m *Module) String() string {
+	return "<module " + m.name + ">"
+}
+
+func (m *Module) get(name Token) interface{} {
+	if v, ok := m.members[name.lexeme]; ok {
+		return v
+	}
+	panic(NewRuntimeErr(name, "module %s has no member '%s'", m.name, name.lexeme))
+}
+
+// define adds a native function, which reports errors as module.name.
+func (m *Module) define(name string, argc int, fn func(i *Interpreter, args []interface{}) interface{}) {
+	m.members[name] = &nativeFunc{name: m.name + "." + name, argc: argc, fn: fn}
+}
+
+// names lists the members in alphabetical order.
+func (m *Module) names() []string {
+	names := make([]string, 0, len(m.members))
+	for name := range m.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
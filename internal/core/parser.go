@@ -1,35 +1,58 @@
 package core
 
-import "fmt"
+import "strings"
 
 type Parser struct {
 	tokens  []Token
+	source  string
 	current int
+	// breakable counts the loops and switches around the current statement
+	breakable int
+	// functions counts the functions around the current statement
+	functions int
 }
 
-func NewParser(t []Token) *Parser {
+func NewParser(t []Token, source string) *Parser {
 	return &Parser{
 		tokens:  t,
+		source:  source,
 		current: 0,
 	}
 }
 
 // 返回全部的声明和语句，不进行 evaluate 操作
-func (p *Parser) doParse() []Stmt {
-	var stmts []Stmt
+func (p *Parser) doParse() (stmts []Stmt, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(ParseErr)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
 	for !p.isAtEnd() {
 		stmts = append(stmts, p.declaration())
 	}
-	return stmts
+	return stmts, nil
 }
 
 func (p *Parser) declaration() Stmt {
 	if p.match(FUN) {
 		return p.function("function")
 	}
+	if p.match(ASYNC) {
+		p.consume(FUN, "expect fun after async")
+		fn := p.function("function").(FuncStmt)
+		fn.async = true
+		return fn
+	}
 	if p.match(VAR) {
 		return p.varDeclaration()
 	}
+	if p.match(RECORD) {
+		return p.recordDeclaration()
+	}
 	return p.statement()
 }
 
@@ -46,14 +69,61 @@ func (p *Parser) function(kind string) Stmt {
 	p.consume(RIGHT_PAREN, "expect ) after params")
 	p.consume(LEFT_BRACE, "expect { before body")
 
+	// break can't leave the function it appears in
+	breakable := p.breakable
+	p.breakable = 0
+	p.functions += 1
+	doc := p.docstring()
 	body := p.blockStmt()
+	p.functions -= 1
+	p.breakable = breakable
+
 	return FuncStmt{
 		name:   name,
 		params: params,
 		body:   body,
+		doc:    doc,
 	}
 }
 
+func (p *Parser) recordDeclaration() Stmt {
+	name := p.consume(IDENTIFIER, "expect record name")
+	p.consume(LEFT_PAREN, "expect ( after record name")
+	var fields []Token
+	seen := make(map[string]bool)
+	for !p.check(RIGHT_PAREN) {
+		field := p.consume(IDENTIFIER, "expect field name")
+		if seen[field.lexeme] || field.lexeme == "with" {
+			panic(NewParseErr(field, "invalid field name '%s' in record %s", field.lexeme, name.lexeme))
+		}
+		seen[field.lexeme] = true
+		fields = append(fields, field)
+		if !p.match(COMMA) {
+			break
+		}
+	}
+	p.consume(RIGHT_PAREN, "expect ) after record fields")
+	p.match(SEMICOLON)
+	return RecordStmt{name: name, fields: fields}
+}
+
+// docstring parses the string literal a function body may start with. It
+// documents the function when it stands on its own, followed by ;, } or a
+// line break, so `"a" |> println;` is still a statement.
+func (p *Parser) docstring() string {
+	if !p.check(STRING) || p.current+1 >= len(p.tokens) {
+		return ""
+	}
+	str, next := p.peek(), p.tokens[p.current+1]
+	endLine := str.line + strings.Count(str.lexeme, "\n")
+	if next.kind != SEMICOLON && next.kind != RIGHT_BRACE && next.line == endLine {
+		return ""
+	}
+	p.advance()
+	p.match(SEMICOLON)
+	return str.literal.(string)
+}
+
 func (p *Parser) varDeclaration() Stmt {
 	name := p.consume(IDENTIFIER, "expected identifier name")
 
@@ -72,12 +142,33 @@ func (p *Parser) statement() Stmt {
 	if p.match(RETURN) {
 		return p.returnStmt()
 	}
+	if p.match(DEFER) {
+		return p.deferStmt()
+	}
+	if p.match(ASSERT) {
+		return p.assertStmt()
+	}
 	if p.match(IF) {
 		return p.ifStmt()
 	}
 	if p.match(WHILE) {
 		return p.whileStmt()
 	}
+	if p.match(DO) {
+		return p.doWhileStmt()
+	}
+	if p.match(LOOP) {
+		return p.loopStmt()
+	}
+	if p.match(SELECT) {
+		return p.selectStmt()
+	}
+	if p.match(SWITCH) {
+		return p.switchStmt()
+	}
+	if p.match(BREAK) {
+		return p.breakStmt()
+	}
 	if p.match(LEFT_BRACE) {
 		return BlockStmt{stmts: p.blockStmt()}
 	}
@@ -97,8 +188,37 @@ func (p *Parser) returnStmt() Stmt {
 	}
 }
 
+func (p *Parser) deferStmt() Stmt {
+	token := p.previous()
+	call, ok := p.expression().(CallExpr)
+	if !ok {
+		panic(NewParseErr(token, "expect function call after defer"))
+	}
+	p.consume(SEMICOLON, "expect ; after defer")
+	return DeferStmt{
+		keyword: token,
+		call:    call,
+	}
+}
+
+func (p *Parser) assertStmt() Stmt {
+	stmt := AssertStmt{keyword: p.previous()}
+	first := p.peek()
+	stmt.expr = p.expression()
+	last := p.previous()
+	stmt.source = p.source[first.pos.offset : last.pos.offset+len(last.lexeme)]
+	if p.match(COMMA) {
+		stmt.message = p.expression()
+	}
+	p.consume(SEMICOLON, "expect ; after assert")
+	return stmt
+}
+
 func (p *Parser) forStmt() Stmt {
 	p.consume(LEFT_PAREN, "expect ( after for")
+	if p.check(IDENTIFIER) && (p.checkNext(IN) || p.checkNext(COMMA)) {
+		return p.forInStmt()
+	}
 	var initializer Stmt
 	if p.match(SEMICOLON) {
 		initializer = nil
@@ -120,7 +240,7 @@ func (p *Parser) forStmt() Stmt {
 	}
 	p.consume(RIGHT_PAREN, "expect ) after loop condition")
 
-	body := p.statement()
+	body := p.loopBody()
 
 	if increment != nil {
 		body = BlockStmt{
@@ -144,6 +264,29 @@ func (p *Parser) forStmt() Stmt {
 	return body
 }
 
+func (p *Parser) forInStmt() Stmt {
+	names := p.loopNames()
+	iterable := p.expression()
+	p.consume(RIGHT_PAREN, "expect ) after for clauses")
+	body := p.loopBody()
+
+	return ForInStmt{
+		names:    names,
+		iterable: iterable,
+		body:     body,
+	}
+}
+
+// loopNames parses `name, name in`.
+func (p *Parser) loopNames() []Token {
+	names := []Token{p.consume(IDENTIFIER, "expect loop variable")}
+	for p.match(COMMA) {
+		names = append(names, p.consume(IDENTIFIER, "expect loop variable"))
+	}
+	p.consume(IN, "expect in after loop variables")
+	return names
+}
+
 func (p *Parser) ifStmt() Stmt {
 	p.consume(LEFT_PAREN, "expect ( after if")
 	condition := p.expression()
@@ -165,11 +308,138 @@ func (p *Parser) whileStmt() Stmt {
 	p.consume(LEFT_PAREN, "expect ( after while")
 	condition := p.expression()
 	p.consume(RIGHT_PAREN, "expect ) after while")
-	body := p.statement()
+	body := p.loopBody()
 
 	return WhileStmt{condition: condition, body: body}
 }
 
+func (p *Parser) doWhileStmt() Stmt {
+	body := p.loopBody()
+	p.consume(WHILE, "expect while after do body")
+	p.consume(LEFT_PAREN, "expect ( after while")
+	condition := p.expression()
+	p.consume(RIGHT_PAREN, "expect ) after while")
+	p.consume(SEMICOLON, "expect ; after do while")
+
+	return DoWhileStmt{body: body, condition: condition}
+}
+
+// loopStmt parses `loop { ... }`, which runs until a break or return.
+func (p *Parser) loopStmt() Stmt {
+	p.consume(LEFT_BRACE, "expect { after loop")
+	p.breakable += 1
+	body := p.blockStmt()
+	p.breakable -= 1
+
+	return WhileStmt{condition: LiteralExpr{true}, body: BlockStmt{stmts: body}}
+}
+
+// loopBody parses the body of a loop, in which break is allowed.
+func (p *Parser) loopBody() Stmt {
+	p.breakable += 1
+	defer func() {
+		p.breakable -= 1
+	}()
+	return p.statement()
+}
+
+func (p *Parser) breakStmt() Stmt {
+	token := p.previous()
+	if p.breakable == 0 {
+		panic(NewParseErr(token, "break outside of a loop or switch"))
+	}
+	p.consume(SEMICOLON, "expect ; after break")
+	return BreakStmt{keyword: token}
+}
+
+func (p *Parser) switchStmt() Stmt {
+	stmt := SwitchStmt{keyword: p.previous()}
+	p.consume(LEFT_PAREN, "expect ( after switch")
+	stmt.subject = p.expression()
+	p.consume(RIGHT_PAREN, "expect ) after switch subject")
+	p.consume(LEFT_BRACE, "expect { after switch")
+
+	p.breakable += 1
+	hasDefault := false
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		c := SwitchCase{keyword: p.peek()}
+		if p.match(DEFAULT) {
+			if hasDefault {
+				panic(NewParseErr(c.keyword, "multiple defaults in switch"))
+			}
+			hasDefault = true
+		} else {
+			p.consume(CASE, "expect case or default in switch")
+			c.values = append(c.values, p.expression())
+			for p.match(COMMA) {
+				c.values = append(c.values, p.expression())
+			}
+		}
+		p.consume(COLON, "expect : after case")
+		for !p.check(CASE) && !p.check(DEFAULT) && !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+			if p.match(FALLTHROUGH) {
+				token := p.previous()
+				p.consume(SEMICOLON, "expect ; after fallthrough")
+				if !p.check(CASE) && !p.check(DEFAULT) {
+					panic(NewParseErr(token, "fallthrough must end a case that is followed by another"))
+				}
+				c.falls = true
+				break
+			}
+			c.body = append(c.body, p.declaration())
+		}
+		stmt.cases = append(stmt.cases, c)
+	}
+	p.breakable -= 1
+	p.consume(RIGHT_BRACE, "expect } after switch cases")
+	return stmt
+}
+
+func (p *Parser) selectStmt() Stmt {
+	stmt := SelectStmt{keyword: p.previous()}
+	p.consume(LEFT_BRACE, "expect { after select")
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		c := SelectCase{keyword: p.peek()}
+		if p.match(DEFAULT) {
+			c.isDefault = true
+		} else {
+			p.consume(CASE, "expect case or default in select")
+			if p.check(IDENTIFIER) && p.checkNext(EQUAL) {
+				name := p.advance()
+				c.name = &name
+				p.advance()
+			}
+			p.selectOperation(&c)
+		}
+		p.consume(COLON, "expect : after case")
+		for !p.check(CASE) && !p.check(DEFAULT) && !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+			c.body = append(c.body, p.declaration())
+		}
+		stmt.cases = append(stmt.cases, c)
+	}
+	p.consume(RIGHT_BRACE, "expect } after select cases")
+	return stmt
+}
+
+// selectOperation parses the channel.recv() or channel.send(value) of a
+// select case.
+func (p *Parser) selectOperation(c *SelectCase) {
+	call, ok := p.call().(CallExpr)
+	var get GetExpr
+	if ok {
+		get, ok = call.callee.(GetExpr)
+	}
+	switch {
+	case ok && get.name.lexeme == "recv" && len(call.args) == 0:
+	case ok && get.name.lexeme == "send" && len(call.args) == 1 && c.name == nil:
+		c.send = true
+		c.value = call.args[0]
+	default:
+		panic(NewParseErr(c.keyword, "expect channel.recv() or channel.send(value) after case"))
+	}
+	c.channel = get.object
+}
+
 func (p *Parser) blockStmt() []Stmt {
 	var stmts []Stmt
 	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
@@ -189,6 +459,27 @@ func (p *Parser) expression() Expr {
 	return p.assignment()
 }
 
+// pipeline parses `value |> f |> g(extra)`, which is sugar for
+// g(f(value), extra): the left operand becomes the first argument.
+func (p *Parser) pipeline() Expr {
+	ex := p.or()
+	for p.match(PIPE_GREATER) {
+		op := p.previous()
+		right := p.or()
+		if call, ok := right.(CallExpr); ok {
+			call.args = append([]Expr{ex}, call.args...)
+			ex = call
+		} else {
+			ex = CallExpr{
+				callee: right,
+				paren:  op,
+				args:   []Expr{ex},
+			}
+		}
+	}
+	return ex
+}
+
 func (p *Parser) or() Expr {
 	ex := p.and()
 	for p.match(OR) {
@@ -218,7 +509,7 @@ func (p *Parser) and() Expr {
 }
 
 func (p *Parser) assignment() Expr {
-	ex := p.or()
+	ex := p.pipeline()
 
 	if p.match(EQUAL) {
 		equals := p.previous()
@@ -231,7 +522,22 @@ func (p *Parser) assignment() Expr {
 				value: value,
 			}
 		}
-		panic(fmt.Sprintf("invalid assign target, %+v", equals))
+		if get, ok := ex.(GetExpr); ok {
+			return SetExpr{
+				object: get.object,
+				name:   get.name,
+				value:  value,
+			}
+		}
+		if ie, ok := ex.(IndexExpr); ok {
+			return SetIndexExpr{
+				object:  ie.object,
+				bracket: ie.bracket,
+				index:   ie.index,
+				value:   value,
+			}
+		}
+		panic(NewParseErr(equals, "invalid assign target"))
 	}
 	return ex
 }
@@ -251,10 +557,10 @@ func (p *Parser) equality() Expr {
 }
 
 func (p *Parser) comparison() Expr {
-	ex := p.term()
+	ex := p.rangeExpr()
 	for p.match(GREATER, GREATER_EQUAL, LESS, LESS_EQUAL) {
 		op := p.previous()
-		right := p.term()
+		right := p.rangeExpr()
 		ex = BinaryExpr{
 			left:     ex,
 			right:    right,
@@ -264,6 +570,20 @@ func (p *Parser) comparison() Expr {
 	return ex
 }
 
+func (p *Parser) rangeExpr() Expr {
+	ex := p.term()
+	if p.match(DOT_DOT, DOT_DOT_EQUAL) {
+		op := p.previous()
+		right := p.term()
+		ex = RangeExpr{
+			left:     ex,
+			right:    right,
+			operator: op,
+		}
+	}
+	return ex
+}
+
 func (p *Parser) term() Expr {
 	ex := p.factor()
 	for p.match(PLUS, MINUS) {
@@ -301,6 +621,23 @@ func (p *Parser) unary() Expr {
 			right:    ex,
 		}
 	}
+	if p.match(AWAIT) {
+		return AwaitExpr{
+			keyword: p.previous(),
+			value:   p.unary(),
+		}
+	}
+	if p.match(SPAWN) {
+		keyword := p.previous()
+		call, ok := p.call().(CallExpr)
+		if !ok {
+			panic(NewParseErr(keyword, "expect function call after spawn"))
+		}
+		return SpawnExpr{
+			keyword: keyword,
+			call:    call,
+		}
+	}
 	return p.call()
 }
 
@@ -309,6 +646,18 @@ func (p *Parser) call() Expr {
 	for {
 		if p.match(LEFT_PAREN) {
 			ex = p.finishCall(ex)
+		} else if p.match(LEFT_BRACKET) {
+			ex = p.finishIndex(ex)
+		} else if p.match(QUESTION) {
+			if p.functions == 0 {
+				panic(NewParseErr(p.previous(), "? outside of a function"))
+			}
+			ex = TryExpr{value: ex, question: p.previous()}
+		} else if p.match(DOT) {
+			ex = GetExpr{
+				object: ex,
+				name:   p.consume(IDENTIFIER, "expect property name after ."),
+			}
 		} else {
 			break
 		}
@@ -318,11 +667,24 @@ func (p *Parser) call() Expr {
 }
 
 func (p *Parser) finishCall(callee Expr) Expr {
-	var args []Expr
+	var (
+		args  []Expr
+		named []NamedArg
+	)
 	if !p.check(RIGHT_PAREN) {
-		args = append(args, p.expression())
-		for p.match(COMMA) {
-			args = append(args, p.expression())
+		for {
+			if p.check(IDENTIFIER) && p.checkNext(COLON) {
+				name := p.advance()
+				p.advance()
+				named = append(named, NamedArg{name: name, value: p.expression()})
+			} else if len(named) > 0 {
+				panic(NewParseErr(p.peek(), "positional argument after named argument"))
+			} else {
+				args = append(args, p.expression())
+			}
+			if !p.match(COMMA) {
+				break
+			}
 		}
 	}
 	p.consume(RIGHT_PAREN, "expect ) after func call")
@@ -330,7 +692,40 @@ func (p *Parser) finishCall(callee Expr) Expr {
 		callee: callee,
 		paren:  p.previous(),
 		args:   args,
+		named:  named,
+	}
+}
+
+// finishIndex parses `[index]` or a `[start:end:step]` slice whose bounds
+// are all optional.
+func (p *Parser) finishIndex(object Expr) Expr {
+	bracket := p.previous()
+	var start Expr
+	if !p.check(COLON) {
+		start = p.expression()
+		if p.match(RIGHT_BRACKET) {
+			return IndexExpr{
+				object:  object,
+				bracket: bracket,
+				index:   start,
+			}
+		}
+	}
+
+	slice := SliceExpr{
+		object:  object,
+		bracket: bracket,
+		start:   start,
+	}
+	p.consume(COLON, "expect : or ] after index")
+	if !p.check(COLON) && !p.check(RIGHT_BRACKET) {
+		slice.end = p.expression()
+	}
+	if p.match(COLON) && !p.check(RIGHT_BRACKET) {
+		slice.step = p.expression()
 	}
+	p.consume(RIGHT_BRACKET, "expect ] after slice")
+	return slice
 }
 
 func (p *Parser) primary() Expr {
@@ -352,12 +747,121 @@ func (p *Parser) primary() Expr {
 		}
 	}
 	if p.match(LEFT_PAREN) {
-		ex := p.expression()
+		return p.group()
+	}
+	if p.match(LEFT_BRACKET) {
+		return p.list()
+	}
+	if p.match(LEFT_BRACE) {
+		return p.mapExpr()
+	}
+	if p.match(HASH_LEFT_BRACE) {
+		return p.setLiteral()
+	}
+
+	panic(NewParseErr(p.peek(), "expect expression"))
+}
+
+// group parses a parenthesized expression, or a tuple when there is a
+// comma: `(a, b)`, `(a,)` or `()`.
+func (p *Parser) group() Expr {
+	paren := p.previous()
+	if p.match(RIGHT_PAREN) {
+		return TupleExpr{paren: paren}
+	}
+	ex := p.expression()
+	if !p.match(COMMA) {
 		p.consume(RIGHT_PAREN, "EXPECT ')'")
 		return GroupExpr{ex}
 	}
 
-	return nil
+	elems := []Expr{ex}
+	for !p.check(RIGHT_PAREN) {
+		elems = append(elems, p.expression())
+		if !p.match(COMMA) {
+			break
+		}
+	}
+	p.consume(RIGHT_PAREN, "expect ) after tuple")
+	return TupleExpr{paren: paren, elems: elems}
+}
+
+func (p *Parser) list() Expr {
+	bracket := p.previous()
+	var elems []Expr
+	for !p.check(RIGHT_BRACKET) {
+		elems = append(elems, p.expression())
+		if len(elems) == 1 && p.match(FOR) {
+			clause := p.compClause()
+			p.consume(RIGHT_BRACKET, "expect ] after comprehension")
+			return ListCompExpr{
+				bracket: bracket,
+				elem:    elems[0],
+				clause:  clause,
+			}
+		}
+		if !p.match(COMMA) {
+			break
+		}
+	}
+	p.consume(RIGHT_BRACKET, "expect ] after list elements")
+	return ListExpr{
+		bracket: bracket,
+		elems:   elems,
+	}
+}
+
+func (p *Parser) setLiteral() Expr {
+	brace := p.previous()
+	var elems []Expr
+	for !p.check(RIGHT_BRACE) {
+		elems = append(elems, p.expression())
+		if !p.match(COMMA) {
+			break
+		}
+	}
+	p.consume(RIGHT_BRACE, "expect } after set elements")
+	return SetLiteralExpr{
+		brace: brace,
+		elems: elems,
+	}
+}
+
+func (p *Parser) mapExpr() Expr {
+	ex := MapExpr{brace: p.previous()}
+	for !p.check(RIGHT_BRACE) {
+		key := p.expression()
+		p.consume(COLON, "expect : after map key")
+		value := p.expression()
+		if len(ex.keys) == 0 && p.match(FOR) {
+			clause := p.compClause()
+			p.consume(RIGHT_BRACE, "expect } after comprehension")
+			return MapCompExpr{
+				brace:  ex.brace,
+				key:    key,
+				value:  value,
+				clause: clause,
+			}
+		}
+		ex.keys = append(ex.keys, key)
+		ex.values = append(ex.values, value)
+		if !p.match(COMMA) {
+			break
+		}
+	}
+	p.consume(RIGHT_BRACE, "expect } after map entries")
+	return ex
+}
+
+// compClause parses the `names in iterable if cond` following the for of a
+// comprehension.
+func (p *Parser) compClause() CompClause {
+	clause := CompClause{names: p.loopNames()}
+	clause.iterable = p.or()
+	if p.match(IF) {
+		clause.cond = p.or()
+	}
+	return clause
 }
 
 func (p *Parser) isAtEnd() bool {
@@ -393,9 +897,16 @@ func (p *Parser) check(tk TokenKind) bool {
 	return p.peek().kind == tk
 }
 
+func (p *Parser) checkNext(tk TokenKind) bool {
+	if p.isAtEnd() {
+		return false
+	}
+	return p.tokens[p.current+1].kind == tk
+}
+
 func (p *Parser) consume(tk TokenKind, msg string) Token {
 	if p.check(tk) {
 		return p.advance()
 	}
-	panic(msg)
+	panic(NewParseErr(p.peek(), "%s", msg))
 }
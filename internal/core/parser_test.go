@@ -0,0 +1,26 @@
+package core
+
+import "testing"
+
+// Syntax errors are returned as diagnostics rather than crashing the host.
+func TestSyntaxErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		"switch (1) {\n  default: break;\n  default: break;\n}": "multiple defaults in switch at line 3, column 3",
+		"switch (1) {\n  case 1:\n    fallthrough;\n}":          "fallthrough must end a case that is followed by another at line 3, column 5",
+		"var ch = channel(1);\nselect {\n  case ch.close():\n}": "expect channel.recv() or channel.send(value) after case at line 3, column 3",
+		"var t = spawn 1 + 2;":                                  "expect function call after spawn at line 1, column 9",
+		"var r = Ok(1)?;":                                       "? outside of a function at line 1, column 14",
+		"record Point(x, x);":                                   "invalid field name 'x' in record Point at line 1, column 17",
+		"fun f(a) {}\nf(a: 1, 2);":                              "positional argument after named argument at line 2, column 9",
+		"defer 1;":                                              "expect function call after defer at line 1, column 1",
+		"switch (1) {\n  case 1 println(1);\n}":                 "expect : after case at line 2, column 10",
+		"println(1 + );":                                        "expect expression at line 1, column 13",
+		"{\n  var a = a;\n}":                                    "can't read local variable 'a' in its own initializer at line 2, column 11",
+		"var x = ;":                                             "expect expression at line 1, column 9",
+	} {
+		err := run(src)
+		if _, ok := err.(ParseErr); !ok || err.Error() != want {
+			t.Errorf("%q: got %v, want %q", src, err, want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// randSource is the random number generator of an interpreter. Tasks share
+// it, so it is locked.
+type randSource struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newRandSource(seed int64) *randSource {
+	return &randSource{r: rand.New(rand.NewSource(seed))}
+}
+
+func (s *randSource) seed(seed int64) {
+	s.mu.Lock()
+	s.r.Seed(seed)
+	s.mu.Unlock()
+}
+
+func (s *randSource) float() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Float64()
+}
+
+// intn returns an int in [0, n).
+func (s *randSource) intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Intn(n)
+}
+
+func (s *randSource) int63n(n int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Int63n(n)
+}
+
+// pick returns k distinct positions in [0, n) in random order. It shuffles
+// only the first k places, remembering the swaps in a map, so it takes k
+// draws however large n is.
+func (s *randSource) pick(n, k int) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	swapped := make(map[int]int)
+	at := func(idx int) int {
+		if v, ok := swapped[idx]; ok {
+			return v
+		}
+		return idx
+	}
+	picked := make([]int, k)
+	for idx := range picked {
+		r := idx + s.r.Intn(n-idx)
+		picked[idx] = at(r)
+		swapped[r] = at(idx)
+	}
+	return picked
+}
+
+func (s *randSource) perm(n int) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Perm(n)
+}
+
+func newRandomModule(src *randSource) *Module {
+	m := NewModule("random")
+	m.define("seed", 1, func(i *Interpreter, args []interface{}) interface{} {
+		src.seed(int64(integerArg(args[0], "random.seed")))
+		return nil
+	})
+	m.define("float", 0, func(i *Interpreter, args []interface{}) interface{} {
+		return src.float()
+	})
+	// int includes both bounds
+	m.define("int", 2, func(i *Interpreter, args []interface{}) interface{} {
+		lo := integerArg(args[0], "random.int")
+		hi := integerArg(args[1], "random.int")
+		if lo > hi {
+			panic(nativeErr(fmt.Sprintf("random.int: lower bound %d is above upper bound %d", lo, hi)))
+		}
+		span := int64(hi) - int64(lo)
+		if span < 0 || span == math.MaxInt64 {
+			panic(nativeErr(fmt.Sprintf("random.int: range from %d to %d is too wide", lo, hi)))
+		}
+		return float64(int64(lo) + src.int63n(span+1))
+	})
+	m.define("choice", 1, func(i *Interpreter, args []interface{}) interface{} {
+		n, at := sequence(args[0], "random.choice")
+		if n == 0 {
+			panic(nativeErr("random.choice: empty sequence"))
+		}
+		return at(src.intn(n))
+	})
+	// shuffle reorders a list in place
+	m.define("shuffle", 1, func(i *Interpreter, args []interface{}) interface{} {
+		l, ok := args[0].(*List)
+		if !ok {
+			panic(nativeErr("random.shuffle: expect a list, got " + repr(args[0])))
+		}
+		shuffled := make([]interface{}, len(l.elems))
+		for idx, from := range src.perm(len(l.elems)) {
+			shuffled[idx] = l.elems[from]
+		}
+		copy(l.elems, shuffled)
+		return nil
+	})
+	// sample picks k elements at distinct positions
+	m.define("sample", 2, func(i *Interpreter, args []interface{}) interface{} {
+		n, at := sequence(args[0], "random.sample")
+		k := countArg(args[1], "random.sample")
+		if k > n {
+			panic(nativeErr(fmt.Sprintf("random.sample: can't pick %d of %d elements", k, n)))
+		}
+		picked := make([]interface{}, k)
+		for idx, from := range src.pick(n, k) {
+			picked[idx] = at(from)
+		}
+		return NewList(picked)
+	})
+	return m
+}
+
+// sequence returns the length of an iterable and the element at an index.
+// Ranges are indexed without materializing them.
+func sequence(v interface{}, fn string) (int, func(idx int) interface{}) {
+	if r, ok := v.(Range); ok {
+		return r.len(), func(idx int) interface{} {
+			return r.start + float64(idx)
+		}
+	}
+	elems := collect(v, fn)
+	return len(elems), func(idx int) interface{} {
+		return elems[idx]
+	}
+}
+
+// integerArg checks for a number without fraction in the range of int64.
+func integerArg(v interface{}, fn string) int {
+	f, ok := v.(float64)
+	if !ok || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		panic(nativeErr(fmt.Sprintf("%s: expect an integer, got %s", fn, repr(v))))
+	}
+	return int(f)
+}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tuple is an immutable sequence, two tuples are equal when their elements
+// are.
+type Tuple struct {
+	elems []interface{}
+}
+
+func NewTuple(elems []interface{}) *Tuple {
+	return &Tuple{elems: elems}
+}
+
+func (t *Tuple) String() string {
+	items := make([]string, len(t.elems))
+	for idx, e := range t.elems {
+		items[idx] = repr(e)
+	}
+	if len(items) == 1 {
+		return "(" + items[0] + ",)"
+	}
+	return "(" + strings.Join(items, ", ") + ")"
+}
+
+func (t *Tuple) iterator() iterator {
+	return indexIterator(len(t.elems), func(idx int) interface{} {
+		return t.elems[idx]
+	})
+}
+
+// RecordType is declared with `record Name(field, ...)`. Calling it, with
+// positional or named arguments, makes a Record.
+type RecordType struct {
+	name   string
+	fields []string
+}
+
+func (r *RecordType) String() string {
+	return "<record " + r.name + ">"
+}
+
+func (r *RecordType) arity() int {
+	return len(r.fields)
+}
+
+func (r *RecordType) call(i *Interpreter, args []interface{}) interface{} {
+	values := make([]interface{}, len(args))
+	copy(values, args)
+	return &Record{typ: r, values: values}
+}
+
+func (r *RecordType) callKeywords(i *Interpreter, args []interface{}, kwargs []keywordArg) interface{} {
+	if len(args) > len(r.fields) {
+		panic(nativeErr(fmt.Sprintf("%s takes %d fields, got %d", r.name, len(r.fields), len(args))))
+	}
+	values := make([]interface{}, len(r.fields))
+	set := make([]bool, len(r.fields))
+	for idx, arg := range args {
+		values[idx], set[idx] = arg, true
+	}
+	for _, kw := range kwargs {
+		idx := r.field(kw.name)
+		if set[idx] {
+			panic(NewRuntimeErr(kw.name, "field '%s' of %s given twice", kw.name.lexeme, r.name))
+		}
+		values[idx], set[idx] = kw.value, true
+	}
+	for idx, ok := range set {
+		if !ok {
+			panic(nativeErr(fmt.Sprintf("missing field '%s' of %s", r.fields[idx], r.name)))
+		}
+	}
+	return &Record{typ: r, values: values}
+}
+
+// field returns the index of the named field.
+func (r *RecordType) field(name Token) int {
+	for idx, f := range r.fields {
+		if f == name.lexeme {
+			return idx
+		}
+	}
+	panic(NewRuntimeErr(name, "record %s has no field '%s'", r.name, name.lexeme))
+}
+
+// Record is an immutable value with named fields. Records of the same type
+// with equal fields are equal.
+type Record struct {
+	typ    *RecordType
+	values []interface{}
+}
+
+func (r *Record) String() string {
+	items := make([]string, len(r.values))
+	for idx, v := range r.values {
+		items[idx] = r.typ.fields[idx] + ": " + repr(v)
+	}
+	return r.typ.name + "(" + strings.Join(items, ", ") + ")"
+}
+
+// get returns a field, or the with method copying the record with some
+// fields replaced.
+func (r *Record) get(name Token) interface{} {
+	if name.lexeme == "with" {
+		return recordWith{r}
+	}
+	return r.values[r.typ.field(name)]
+}
+
+// recordWith is the with method of a record, e.g. `p.with(x: 3)`.
+type recordWith struct {
+	r *Record
+}
+
+func (w recordWith) String() string {
+	return "<native fn with>"
+}
+
+func (w recordWith) arity() int {
+	return 0
+}
+
+func (w recordWith) call(i *Interpreter, args []interface{}) interface{} {
+	return w.r
+}
+
+func (w recordWith) callKeywords(i *Interpreter, args []interface{}, kwargs []keywordArg) interface{} {
+	if len(args) > 0 {
+		panic(nativeErr("with: expect named arguments only"))
+	}
+	values := make([]interface{}, len(w.r.values))
+	copy(values, w.r.values)
+	for _, kw := range kwargs {
+		values[w.r.typ.field(kw.name)] = kw.value
+	}
+	return &Record{typ: w.r.typ, values: values}
+}
+
+// keywordArg is a `name: value` argument of a call.
+type keywordArg struct {
+	name  Token
+	value interface{}
+}
+
+// keywordCallable is implemented by callables accepting named arguments.
+type keywordCallable interface {
+	Callalble
+	callKeywords(i *Interpreter, args []interface{}, kwargs []keywordArg) interface{}
+}
+
+// compositeKey is the hash key of a tuple or record: the keys of its
+// elements chained in order, tagged with the record type. Go compares it
+// field by field, so equal values share a key.
+type compositeKey struct {
+	tag   interface{}
+	elems interface{}
+}
+
+type keyCell struct {
+	head interface{}
+	tail interface{}
+}
+
+func newCompositeKey(tag interface{}, elems []interface{}) (interface{}, bool) {
+	var chain interface{}
+	for idx := len(elems) - 1; idx >= 0; idx-- {
+		k, ok := hashable(elems[idx])
+		if !ok {
+			return nil, false
+		}
+		chain = keyCell{head: k, tail: chain}
+	}
+	return compositeKey{tag: tag, elems: chain}, true
+}
+
+// tupleTag tags the keys of tuples, records are tagged by their type.
+type tupleTag struct{}
+
+// elemsEqual compares two sequences with isEqual.
+func elemsEqual(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if !isEqual(a[idx], b[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *Interpreter) evaluateTupleExpr(v TupleExpr) interface{} {
+	elems := make([]interface{}, len(v.elems))
+	for idx, e := range v.elems {
+		elems[idx] = i.interpret(e)
+	}
+	return NewTuple(elems)
+}
+
+func (i *Interpreter) evaluateRecordStmt(v RecordStmt) interface{} {
+	fields := make([]string, len(v.fields))
+	for idx, f := range v.fields {
+		fields[idx] = f.lexeme
+	}
+	i.globals.define(v.name.lexeme, &RecordType{name: v.name.lexeme, fields: fields})
+	return nil
+}
+
+// evaluateSetExpr handles `object.name = value`. No value has assignable
+// properties yet, records and tuples are immutable.
+func (i *Interpreter) evaluateSetExpr(v SetExpr) interface{} {
+	object := i.interpret(v.object)
+	if r, ok := object.(*Record); ok {
+		panic(NewRuntimeErr(v.name, "can't assign to field '%s', record %s is immutable, use with", v.name.lexeme, r.typ.name))
+	}
+	panic(NewRuntimeErr(v.name, "can't assign to property '%s' of %s", v.name.lexeme, repr(object)))
+}
@@ -48,6 +48,22 @@ func NewResolver(i *Interpreter) *Resolver {
 	return r
 }
 
+// resolveProgram resolves the statements of a script, returning the
+// ParseErr of a misused variable.
+func (r *Resolver) resolveProgram(stmts []Stmt) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(ParseErr)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	r.resolve(BlockStmt{stmts: stmts})
+	return nil
+}
+
 func (r *Resolver) resolve(s interface{}) {
 	switch v := s.(type) {
 	case AssignExpr:
@@ -66,6 +82,45 @@ func (r *Resolver) resolve(s interface{}) {
 		r.resolveLogicalExpr(v)
 	case CallExpr:
 		r.resolveCallExpr(v)
+	case TupleExpr:
+		for _, e := range v.elems {
+			r.resolve(e)
+		}
+	case TryExpr:
+		r.resolve(v.value)
+	case SetLiteralExpr:
+		for _, e := range v.elems {
+			r.resolve(e)
+		}
+	case SetExpr:
+		r.resolve(v.value)
+		r.resolve(v.object)
+	case GetExpr:
+		r.resolve(v.object)
+	case SpawnExpr:
+		r.resolveCallExpr(v.call)
+	case AwaitExpr:
+		r.resolve(v.value)
+	case SelectStmt:
+		r.resolveSelectStmt(v)
+	case SwitchStmt:
+		r.resolveSwitchStmt(v)
+	case RangeExpr:
+		r.resolveRangeExpr(v)
+	case ListExpr:
+		r.resolveListExpr(v)
+	case IndexExpr:
+		r.resolveIndexExpr(v)
+	case SliceExpr:
+		r.resolveSliceExpr(v)
+	case SetIndexExpr:
+		r.resolveSetIndexExpr(v)
+	case MapExpr:
+		r.resolveMapExpr(v)
+	case ListCompExpr:
+		r.resolveListCompExpr(v)
+	case MapCompExpr:
+		r.resolveMapCompExpr(v)
 	case VarStmt:
 		r.resolveVarStmt(v)
 	case ExprStmt:
@@ -76,10 +131,23 @@ func (r *Resolver) resolve(s interface{}) {
 		r.resolveIfStmt(v)
 	case WhileStmt:
 		r.resolveWhileStmt(v)
+	case DoWhileStmt:
+		r.resolve(v.body)
+		r.resolve(v.condition)
+	case ForInStmt:
+		r.resolveForInStmt(v)
 	case FuncStmt:
 		r.resolveFunctionStmt(v)
+	case RecordStmt:
+		r.declare(v.name)
+		r.define(v.name)
 	case ReturnStmt:
 		r.resolveReturnStmt(v)
+	case DeferStmt:
+		r.resolveCallExpr(v.call)
+	case AssertStmt:
+		r.resolveAssertStmt(v)
+	case BreakStmt:
 	case []Stmt:
 		for _, i := range v {
 			r.resolve(i)
@@ -109,18 +177,18 @@ func (r *Resolver) resolveVarStmt(v VarStmt) interface{} {
 func (r *Resolver) resolveVarExpr(v VarExpr) interface{} {
 	if !r.scopes.empty() {
 		if res, ok := r.scopes.peek()[v.name.lexeme]; ok && !res {
-			panic(fmt.Sprintf("can't read local variable in its own initializer, line: %d, %s", v.name.line, v.name.lexeme))
+			panic(NewParseErr(v.name, "can't read local variable '%s' in its own initializer", v.name.lexeme))
 		}
 	}
 
-	r.resolveLocal(v, v.name)
+	r.resolveLocal(v.name)
 	return nil
 }
 
-func (r *Resolver) resolveLocal(ex Expr, n Token) {
+func (r *Resolver) resolveLocal(n Token) {
 	for i := r.scopes.size() - 1; i >= 0; i-- {
 		if _, ok := r.scopes.get(i)[n.lexeme]; ok {
-			r.inter.resolve(ex, r.scopes.size()-1-i)
+			r.inter.resolve(n, r.scopes.size()-1-i)
 			return
 		}
 	}
@@ -148,12 +216,63 @@ func (r *Resolver) resolveReturnStmt(st ReturnStmt) interface{} {
 	return nil
 }
 
+func (r *Resolver) resolveAssertStmt(st AssertStmt) interface{} {
+	r.resolve(st.expr)
+	if st.message != nil {
+		r.resolve(st.message)
+	}
+	return nil
+}
+
+func (r *Resolver) resolveSelectStmt(st SelectStmt) interface{} {
+	for _, c := range st.cases {
+		if c.channel != nil {
+			r.resolve(c.channel)
+		}
+		if c.value != nil {
+			r.resolve(c.value)
+		}
+		r.beginScope()
+		if c.name != nil {
+			r.declare(*c.name)
+			r.define(*c.name)
+		}
+		r.resolve(c.body)
+		r.endScope()
+	}
+	return nil
+}
+
+// resolveSwitchStmt resolves every case body like a block of its own.
+func (r *Resolver) resolveSwitchStmt(st SwitchStmt) interface{} {
+	r.resolve(st.subject)
+	for _, c := range st.cases {
+		for _, value := range c.values {
+			r.resolve(value)
+		}
+		r.resolveBlockStmt(BlockStmt{stmts: c.body})
+	}
+	return nil
+}
+
 func (r *Resolver) resolveWhileStmt(st WhileStmt) interface{} {
 	r.resolve(st.condition)
 	r.resolve(st.body)
 	return nil
 }
 
+func (r *Resolver) resolveForInStmt(st ForInStmt) interface{} {
+	r.resolve(st.iterable)
+	r.beginScope()
+	for _, name := range st.names {
+		r.declare(name)
+		r.define(name)
+	}
+	r.resolve(st.body)
+	r.endScope()
+	return nil
+}
+
 func (r *Resolver) resolveBinaryExpr(ex BinaryExpr) interface{} {
 	r.resolve(ex.left)
 	r.resolve(ex.right)
@@ -166,9 +285,84 @@ func (r *Resolver) resolveCallExpr(ex CallExpr) interface{} {
 	for _, arg := range ex.args {
 		r.resolve(arg)
 	}
+	for _, arg := range ex.named {
+		r.resolve(arg.value)
+	}
+	return nil
+}
+
+func (r *Resolver) resolveRangeExpr(ex RangeExpr) interface{} {
+	r.resolve(ex.left)
+	r.resolve(ex.right)
+	return nil
+}
+
+func (r *Resolver) resolveListExpr(ex ListExpr) interface{} {
+	for _, e := range ex.elems {
+		r.resolve(e)
+	}
+	return nil
+}
+
+func (r *Resolver) resolveIndexExpr(ex IndexExpr) interface{} {
+	r.resolve(ex.object)
+	r.resolve(ex.index)
+	return nil
+}
+
+func (r *Resolver) resolveSliceExpr(ex SliceExpr) interface{} {
+	r.resolve(ex.object)
+	for _, e := range []Expr{ex.start, ex.end, ex.step} {
+		if e != nil {
+			r.resolve(e)
+		}
+	}
+	return nil
+}
+
+func (r *Resolver) resolveSetIndexExpr(ex SetIndexExpr) interface{} {
+	r.resolve(ex.value)
+	r.resolve(ex.object)
+	r.resolve(ex.index)
+	return nil
+}
+
+func (r *Resolver) resolveMapExpr(ex MapExpr) interface{} {
+	for idx := range ex.keys {
+		r.resolve(ex.keys[idx])
+		r.resolve(ex.values[idx])
+	}
 	return nil
 }
 
+func (r *Resolver) resolveListCompExpr(ex ListCompExpr) interface{} {
+	r.resolveComprehension(ex.clause, ex.elem)
+	return nil
+}
+
+func (r *Resolver) resolveMapCompExpr(ex MapCompExpr) interface{} {
+	r.resolveComprehension(ex.clause, ex.key, ex.value)
+	return nil
+}
+
+// resolveComprehension gives the loop variables a scope of their own so
+// they don't leak into the enclosing one.
+func (r *Resolver) resolveComprehension(clause CompClause, exprs ...Expr) {
+	r.resolve(clause.iterable)
+	r.beginScope()
+	for _, name := range clause.names {
+		r.declare(name)
+		r.define(name)
+	}
+	if clause.cond != nil {
+		r.resolve(clause.cond)
+	}
+	for _, ex := range exprs {
+		r.resolve(ex)
+	}
+	r.endScope()
+}
+
 func (r *Resolver) resolveGroupExpr(ex GroupExpr) interface{} {
 	r.resolve(ex.expression)
 	return nil
@@ -210,7 +404,7 @@ func (r *Resolver) resolveFunction(fc FuncStmt) interface{} {
 
 func (r *Resolver) resolveAssignExpr(ex AssignExpr) interface{} {
 	r.resolve(ex.value)
-	r.resolveLocal(ex, ex.name)
+	r.resolveLocal(ex.name)
 	return nil
 }
 
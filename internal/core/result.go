@@ -0,0 +1,215 @@
+package core
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Result is Ok(value) or Err(error), Maybe is Some(value) or None. They
+// report expected failures as values, `expr?` unwraps them or returns the
+// failure from the enclosing function. Both compare and hash by value.
+type Result struct {
+	ok    bool
+	value interface{}
+}
+
+type Maybe struct {
+	some  bool
+	value interface{}
+}
+
+// none is the None value.
+var none = &Maybe{}
+
+type resultTag struct {
+	ok bool
+}
+
+type optionTag struct {
+	some bool
+}
+
+func newOk(i *Interpreter, args []interface{}) interface{} {
+	return &Result{ok: true, value: args[0]}
+}
+
+func newErr(i *Interpreter, args []interface{}) interface{} {
+	return &Result{ok: false, value: args[0]}
+}
+
+func newSome(i *Interpreter, args []interface{}) interface{} {
+	return &Maybe{some: true, value: args[0]}
+}
+
+func (r *Result) String() string {
+	if r.ok {
+		return "Ok(" + repr(r.value) + ")"
+	}
+	return "Err(" + repr(r.value) + ")"
+}
+
+func (r *Result) get(name Token) interface{} {
+	switch name.lexeme {
+	case "isOk":
+		return constFunc("isOk", r.ok)
+	case "isErr":
+		return constFunc("isErr", !r.ok)
+	case "unwrap":
+		return &nativeFunc{name: "unwrap", argc: 0, fn: func(i *Interpreter, args []interface{}) interface{} {
+			if !r.ok {
+				panic(nativeErr("unwrap on " + r.String()))
+			}
+			return r.value
+		}}
+	case "unwrapOr":
+		return unwrapOr(r.ok, r.value)
+	case "error":
+		if r.ok {
+			return constFunc("error", nil)
+		}
+		return constFunc("error", r.value)
+	}
+	panic(NewRuntimeErr(name, "result has no property '%s'", name.lexeme))
+}
+
+func (o *Maybe) String() string {
+	if o.some {
+		return "Some(" + repr(o.value) + ")"
+	}
+	return "None"
+}
+
+func (o *Maybe) get(name Token) interface{} {
+	switch name.lexeme {
+	case "isSome":
+		return constFunc("isSome", o.some)
+	case "isNone":
+		return constFunc("isNone", !o.some)
+	case "unwrap":
+		return &nativeFunc{name: "unwrap", argc: 0, fn: func(i *Interpreter, args []interface{}) interface{} {
+			if !o.some {
+				panic(nativeErr("unwrap on None"))
+			}
+			return o.value
+		}}
+	case "unwrapOr":
+		return unwrapOr(o.some, o.value)
+	}
+	panic(NewRuntimeErr(name, "option has no property '%s'", name.lexeme))
+}
+
+// constFunc is a method without arguments returning v.
+func constFunc(name string, v interface{}) *nativeFunc {
+	return &nativeFunc{name: name, argc: 0, fn: func(i *Interpreter, args []interface{}) interface{} {
+		return v
+	}}
+}
+
+// unwrapOr returns the wrapped value when present, else its argument.
+func unwrapOr(present bool, value interface{}) *nativeFunc {
+	return &nativeFunc{name: "unwrapOr", argc: 1, fn: func(i *Interpreter, args []interface{}) interface{} {
+		if present {
+			return value
+		}
+		return args[0]
+	}}
+}
+
+func (i *Interpreter) evaluateTryExpr(v TryExpr) interface{} {
+	value := i.interpret(v.value)
+	switch r := value.(type) {
+	case *Result:
+		if r.ok {
+			return r.value
+		}
+	case *Maybe:
+		if r.some {
+			return r.value
+		}
+	default:
+		panic(NewRuntimeErr(v.question, "? expects a result or an option, got %s", repr(value)))
+	}
+	panic(ReturnErr{value: value})
+}
+
+// getFunc is indexing that reports a missing element as None rather than
+// failing. get(seq, i) takes lists, tuples, strings and ranges, negative
+// indexes count from the end, and get(map, key) looks up a key.
+func getFunc(i *Interpreter, args []interface{}) interface{} {
+	if m, ok := args[0].(*Map); ok {
+		if _, ok := hashable(args[1]); !ok {
+			panic(nativeErr("get: unhashable key " + repr(args[1])))
+		}
+		if v, ok := m.get(args[1], Token{}); ok {
+			return &Maybe{some: true, value: v}
+		}
+		return none
+	}
+
+	var length int
+	var at func(idx int) interface{}
+	switch o := args[0].(type) {
+	case *List:
+		length, at = len(o.elems), func(idx int) interface{} { return o.elems[idx] }
+	case *Tuple:
+		length, at = len(o.elems), func(idx int) interface{} { return o.elems[idx] }
+	case string:
+		runes := []rune(o)
+		length, at = len(runes), func(idx int) interface{} { return string(runes[idx]) }
+	case Range:
+		length, at = o.len(), func(idx int) interface{} { return o.start + float64(idx) }
+	default:
+		panic(nativeErr("get: value " + repr(args[0]) + " is not indexable"))
+	}
+	f, ok := args[1].(float64)
+	if !ok || f != math.Trunc(f) {
+		panic(nativeErr("get: index must be an integer, got " + repr(args[1])))
+	}
+	if f < 0 {
+		f += float64(length)
+	}
+	if f < 0 || f >= float64(length) {
+		return none
+	}
+	return &Maybe{some: true, value: at(int(f))}
+}
+
+// parseNumberFunc reads a number from a string, surrounding white space
+// aside, and returns Ok with it or Err.
+func parseNumberFunc(i *Interpreter, args []interface{}) interface{} {
+	s := stringArg(args[0], "parseNumber")
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return &Result{ok: false, value: "parseNumber: invalid number " + repr(s)}
+	}
+	return &Result{ok: true, value: f}
+}
+
+// tryFunc calls its first argument with the others, returning Ok with the
+// result or Err with the message of a runtime error. It turns any function
+// into one that reports failure as a value.
+func tryFunc(i *Interpreter, args []interface{}) (result interface{}) {
+	if len(args) == 0 {
+		panic(nativeErr("try: expect a function"))
+	}
+	fn := toCallable(args[0], "try")
+	args = args[1:]
+	if fn.arity() != variadic && fn.arity() != len(args) {
+		panic(nativeErr("try: args num not match"))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch err := r.(type) {
+			case RuntimeErr:
+				result = &Result{ok: false, value: err.msg}
+			case nativeErr:
+				result = &Result{ok: false, value: string(err)}
+			default:
+				panic(r)
+			}
+		}
+	}()
+	return &Result{ok: true, value: fn.call(i, args)}
+}
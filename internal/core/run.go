@@ -2,22 +2,27 @@ package core
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+
+	"github.com/sirupsen/logrus"
 )
 
-func RunFile(path string) error {
+// RunFile runs the script at path. It returns the error that stopped the
+// script: ScanErrs, a ParseErr, a RuntimeErr, or the failure to read the
+// file.
+func RunFile(path string, opts ...Option) error {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
 
-	run(string(data))
-	return nil
+	return run(string(data), opts...)
 }
 
-func RunPrompt() {
+func RunPrompt(opts ...Option) {
 	reader := bufio.NewReader(os.Stdin)
 
 	for {
@@ -26,30 +31,68 @@ func RunPrompt() {
 		if len(text) == 0 {
 			break
 		}
-		run(text)
+		if err := run(text, opts...); err != nil {
+			logrus.Errorln(err)
+		}
 	}
 }
 
-func run(source string) {
+func run(source string, opts ...Option) (err error) {
 	scan := NewScanner(source)
 
 	scan.scanTokens()
+	if len(scan.errs) > 0 {
+		return ScanErrs(scan.errs)
+	}
 
 	// for _, v := range scan.tokens {
 	// 	fmt.Printf("token: %+v\n", v)
 	// }
 
-	parser := NewParser(scan.tokens)
-	stmts := parser.doParse()
+	parser := NewParser(scan.tokens, source)
+	stmts, err := parser.doParse()
+	if err != nil {
+		return err
+	}
 	// fmt.Printf("stmt s%+v\n", stmts)
 
-	inter := NewInterpreter()
+	inter := NewInterpreter(opts...)
+	// the main task runs first, spawned ones take turns with it
+	inter.loop.gil.Lock()
+	defer inter.loop.gil.Unlock()
 
 	resolver := NewResolver(inter)
-	resolver.resolve(BlockStmt{stmts: stmts})
+	if err := resolver.resolveProgram(stmts); err != nil {
+		return err
+	}
 
+	defer func() {
+		r := recover()
+		// spawned tasks are waited for even when the script failed
+		if failure := inter.tasks.finish(inter); r == nil {
+			r = failure
+		}
+		if r != nil {
+			switch e := r.(type) {
+			case RuntimeErr:
+				err = e
+			case nativeErr:
+				err = errors.New(string(e))
+			default:
+				panic(r)
+			}
+		}
+	}()
+	// abandoned coroutines would otherwise block their goroutines forever
+	defer inter.coroutines.closeAll(inter)
+	inter.pushDefers()
+	defer inter.runDefers()
 	for _, s := range stmts {
 		inter.interpret(s)
 		// fmt.Printf("res: %v\n", inter.interpret(s))
 	}
+	// keep going until every async function and timer is done
+	inter.loop.run()
+	inter.loop.checkUnhandled()
+	return nil
 }
@@ -1,20 +1,31 @@
 package core
 
 import (
-	"os"
+	"fmt"
+	"math/big"
 	"strconv"
-
-	"github.com/sirupsen/logrus"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type scanner struct {
 	tokens []Token
 	source string
 	length int
+	errs   []error
 
 	start   int
 	current int
 	line    int
+
+	// lineStart is the byte offset of the current line and col the number
+	// of runes consumed on it, startLine and startPos locate the token
+	// being scanned.
+	lineStart int
+	col       int
+	startLine int
+	startPos  Position
 }
 
 func NewScanner(source string) *scanner {
@@ -28,10 +39,15 @@ func NewScanner(source string) *scanner {
 func (s *scanner) scanTokens() {
 	for !s.isAtEnd() {
 		s.start = s.current
+		s.startLine = s.line
+		s.startPos = s.position()
 		s.scanToken()
 	}
 
-	s.tokens = append(s.tokens, NewToken(EOF, "", nil, s.line))
+	s.start = s.current
+	s.startLine = s.line
+	s.startPos = s.position()
+	s.tokens = append(s.tokens, s.newToken(EOF, "", nil))
 }
 
 func (s *scanner) scanToken() {
@@ -45,10 +61,26 @@ func (s *scanner) scanToken() {
 		s.addToken(LEFT_BRACE)
 	case '}':
 		s.addToken(RIGHT_BRACE)
+	case '[':
+		s.addToken(LEFT_BRACKET)
+	case ']':
+		s.addToken(RIGHT_BRACKET)
+	case ':':
+		s.addToken(COLON)
+	case '?':
+		s.addToken(QUESTION)
 	case ',':
 		s.addToken(COMMA)
 	case '.':
-		s.addToken(DOT)
+		if s.match('.') {
+			if s.match('=') {
+				s.addToken(DOT_DOT_EQUAL)
+			} else {
+				s.addToken(DOT_DOT)
+			}
+		} else {
+			s.addToken(DOT)
+		}
 	case '-':
 		s.addToken(MINUS)
 	case '+':
@@ -58,52 +90,68 @@ func (s *scanner) scanToken() {
 	case '*':
 		s.addToken(STAR)
 	case '!':
-		if s.match("=") {
+		if s.match('=') {
 			s.addToken(BANG_EQUAL)
 		} else {
 			s.addToken(BANG)
 		}
 	case '=':
-		if s.match("=") {
+		if s.match('=') {
 			s.addToken(EQUAL_EQUAL)
 		} else {
 			s.addToken(EQUAL)
 		}
 	case '<':
-		if s.match("=") {
+		if s.match('=') {
 			s.addToken(LESS_EQUAL)
 		} else {
 			s.addToken(LESS)
 		}
 	case '>':
-		if s.match("=") {
+		if s.match('=') {
 			s.addToken(GREATER_EQUAL)
 		} else {
 			s.addToken(GREATER)
 		}
+	case '#':
+		if s.match('{') {
+			s.addToken(HASH_LEFT_BRACE)
+		} else {
+			s.error("invalid char '#', expect #{")
+		}
+	case '|':
+		if s.match('>') {
+			s.addToken(PIPE_GREATER)
+		} else {
+			s.error("invalid char '|', expect |>")
+		}
 	case '/':
-		if s.match("/") {
+		if s.match('/') {
 			for s.peek() != '\n' && !s.isAtEnd() {
 				s.advance()
 			}
+		} else if s.match('*') {
+			s.blockComment()
 		} else {
 			s.addToken(SLASH)
 		}
-	case ' ', '\r', '\t':
-	case '\n':
-		s.line += 1
+	case ' ', '\r', '\t', '\n':
 	case '"':
-		str := s.string()
-		s.addTokenValue(STRING, str)
+		s.addTokenValue(STRING, s.string(false))
 	default:
 		if s.isDigit(c) {
 			v := s.number()
 			s.addTokenValue(NUMBER, v)
+		} else if c == 'r' && s.peek() == '"' {
+			s.advance()
+			s.addTokenValue(STRING, s.string(true))
 		} else if s.isAlpha(c) {
 			v := s.identifier()
 			s.tokens = append(s.tokens, v)
 		} else {
-			logrus.Errorf("invalid char: %s at line %d", c, s.line)
+			if c != utf8.RuneError || s.current-s.start > 1 {
+				s.error(fmt.Sprintf("invalid char %q", c))
+			}
 		}
 	}
 }
@@ -114,22 +162,28 @@ func (s *scanner) isAtEnd() bool {
 
 func (s *scanner) advance() rune {
 	if s.isAtEnd() {
-		return '0'
+		return 0
+	}
+	emit, size := utf8.DecodeRuneInString(s.source[s.current:])
+	if emit == utf8.RuneError && size == 1 {
+		s.error("invalid UTF-8 encoding")
+	}
+	s.current += size
+	if emit == '\n' {
+		s.line += 1
+		s.lineStart = s.current
+		s.col = 0
+	} else {
+		s.col += 1
 	}
-	emit := rune(s.source[s.current])
-	s.current += 1
 	return emit
 }
 
-func (s *scanner) match(c string) bool {
-	if s.isAtEnd() {
+func (s *scanner) match(c rune) bool {
+	if s.isAtEnd() || s.peek() != c {
 		return false
 	}
-
-	if s.source[s.current:s.current+1] != c {
-		return false
-	}
-	s.current += 1
+	s.advance()
 	return true
 }
 
@@ -137,31 +191,182 @@ func (s *scanner) peek() rune {
 	if s.isAtEnd() {
 		return 0
 	}
-	return rune(s.source[s.current])
+	c, _ := utf8.DecodeRuneInString(s.source[s.current:])
+	return c
 }
 
 func (s *scanner) peekNext() rune {
-	if s.current+1 >= s.length {
+	if s.isAtEnd() {
+		return 0
+	}
+	_, size := utf8.DecodeRuneInString(s.source[s.current:])
+	if s.current+size >= s.length {
 		return 0
 	}
-	return rune(s.source[s.current])
+	c, _ := utf8.DecodeRuneInString(s.source[s.current+size:])
+	return c
 }
 
-func (s *scanner) string() string {
-	for s.peek() != '"' && !s.isAtEnd() {
-		if s.peek() == '\n' {
-			s.line += 1
+// position reports where the next rune to be consumed sits.
+func (s *scanner) position() Position {
+	return Position{
+		offset:  s.current,
+		col:     s.col + 1,
+		byteCol: s.current - s.lineStart + 1,
+	}
+}
+
+func (s *scanner) error(msg string) {
+	s.errs = append(s.errs, ScanErr{line: s.startLine, col: s.startPos.col, msg: msg})
+}
+
+// blockComment skips a /* ... */ comment, which may nest.
+func (s *scanner) blockComment() {
+	depth := 1
+	for depth > 0 {
+		if s.isAtEnd() {
+			s.error("unterminated block comment")
+			return
+		}
+		c := s.advance()
+		if c == '/' && s.match('*') {
+			depth += 1
+		} else if c == '*' && s.match('/') {
+			depth -= 1
 		}
+	}
+}
+
+// string scans a string literal whose opening quote has been consumed. Raw
+// strings keep backslashes as written.
+func (s *scanner) string(raw bool) string {
+	if s.peek() == '"' && s.peekNext() == '"' {
 		s.advance()
+		s.advance()
+		return s.tripleString(raw)
+	}
+
+	begin := s.current
+	for s.peek() != '"' && !s.isAtEnd() {
+		if s.advance() == '\\' && !raw && !s.isAtEnd() {
+			s.advance()
+		}
 	}
 
 	if s.isAtEnd() {
-		logrus.Errorf("unterminate string at line %d\n", s.line)
-		os.Exit(-1)
+		s.error("unterminated string")
+		return ""
 	}
 	s.advance()
 
-	return s.source[s.start+1 : s.current-1]
+	str := s.source[begin : s.current-1]
+	if raw {
+		return str
+	}
+	return s.unescape(str)
+}
+
+// tripleString scans a """ multi-line string. A line break right after the
+// opening quotes and the whitespace before the closing ones are dropped,
+// then the indentation common to all non-blank lines is stripped.
+func (s *scanner) tripleString(raw bool) string {
+	begin := s.current
+	for !strings.HasPrefix(s.source[s.current:], `"""`) {
+		if s.isAtEnd() {
+			s.error("unterminated string")
+			return ""
+		}
+		if s.advance() == '\\' && !raw && !s.isAtEnd() {
+			s.advance()
+		}
+	}
+	str := s.source[begin:s.current]
+	s.advance()
+	s.advance()
+	s.advance()
+
+	str = dedent(str)
+	if raw {
+		return str
+	}
+	return s.unescape(str)
+}
+
+func dedent(str string) string {
+	lines := strings.Split(str, "\n")
+	if strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+
+	for idx, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			lines[idx] = line[indent:]
+		} else if strings.TrimSpace(line) == "" {
+			lines[idx] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// unescape replaces the backslash escapes \n, \t, \r, \0, \\, \" and
+// \u{hex} in a string literal.
+func (s *scanner) unescape(str string) string {
+	if !strings.Contains(str, `\`) {
+		return str
+	}
+
+	var b strings.Builder
+	for idx := 0; idx < len(str); idx++ {
+		if str[idx] != '\\' || idx+1 == len(str) {
+			b.WriteByte(str[idx])
+			continue
+		}
+		idx += 1
+		switch str[idx] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '0':
+			b.WriteByte(0)
+		case '\\', '"':
+			b.WriteByte(str[idx])
+		case 'u':
+			end := strings.IndexByte(str[idx:], '}')
+			if end < 0 || str[idx+1] != '{' {
+				s.error(`invalid escape sequence, expect \u{hex}`)
+				continue
+			}
+			v, err := strconv.ParseUint(str[idx+2:idx+end], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(v)) {
+				s.error(fmt.Sprintf(`invalid escape sequence \%s`, str[idx:idx+end+1]))
+			} else {
+				b.WriteRune(rune(v))
+			}
+			idx += end
+		default:
+			c, size := utf8.DecodeRuneInString(str[idx:])
+			s.error(fmt.Sprintf(`invalid escape sequence \%c`, c))
+			idx += size - 1
+		}
+	}
+	return b.String()
 }
 
 func (s *scanner) isDigit(c rune) bool {
@@ -169,32 +374,128 @@ func (s *scanner) isDigit(c rune) bool {
 
 }
 
+// isAlpha reports whether c may start an identifier: any Unicode letter
+// or '_'.
 func (s *scanner) isAlpha(c rune) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+	return unicode.IsLetter(c) || c == '_'
 }
 
+// isAlphaNumeric reports whether c may continue an identifier, which also
+// admits digits and combining marks.
+func (s *scanner) isAlphaNumeric(c rune) bool {
+	return s.isAlpha(c) || unicode.IsDigit(c) || unicode.IsMark(c)
+}
+
+func (s *scanner) isHexDigit(c rune) bool {
+	return s.isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func (s *scanner) isOctDigit(c rune) bool {
+	return c >= '0' && c <= '7'
+}
+
+func (s *scanner) isBinDigit(c rune) bool {
+	return c == '0' || c == '1'
+}
+
+// number scans decimal literals such as 12, 1.5, 2.5E-3 and 1_000_000, as
+// well as 0x, 0o and 0b prefixed integers. The leading digit has already
+// been consumed. Integers beyond 2^53, in any base, become a BigInt.
 func (s *scanner) number() interface{} {
-	for s.isDigit(s.peek()) {
-		s.advance()
+	if s.source[s.start] == '0' {
+		switch s.peek() {
+		case 'x', 'X':
+			return s.prefixedNumber(16, "hexadecimal", s.isHexDigit)
+		case 'o', 'O':
+			return s.prefixedNumber(8, "octal", s.isOctDigit)
+		case 'b', 'B':
+			return s.prefixedNumber(2, "binary", s.isBinDigit)
+		}
 	}
 
+	ok := s.digits(s.isDigit, true)
 	if s.peek() == '.' && s.isDigit(s.peekNext()) {
 		s.advance()
-		for s.isDigit(s.peek()) {
+		ok = s.digits(s.isDigit, false) && ok
+	}
+	if s.peek() == 'e' || s.peek() == 'E' {
+		s.advance()
+		if s.peek() == '+' || s.peek() == '-' {
 			s.advance()
 		}
+		if !s.isDigit(s.peek()) {
+			return s.invalidNumber("missing exponent digits")
+		}
+		ok = s.digits(s.isDigit, false) && ok
+	}
+	if s.isAlpha(s.peek()) || s.isDigit(s.peek()) {
+		return s.invalidNumber(fmt.Sprintf("invalid char %q", s.peek()))
+	}
+	if !ok {
+		return s.invalidNumber("'_' must separate successive digits")
 	}
 
-	v, err := strconv.ParseFloat(s.source[s.start:s.current], 64)
+	text := strings.ReplaceAll(s.source[s.start:s.current], "_", "")
+	if n, ok := parseBigInt(text); ok {
+		return n
+	}
+	v, err := strconv.ParseFloat(text, 64)
 	if err != nil {
-		logrus.Errorf("invalid number %s at line %d\n", s.source[s.start:s.current], s.line)
-		os.Exit(-1)
+		return s.invalidNumber("value out of range")
 	}
 	return v
 }
 
+func (s *scanner) prefixedNumber(base int, name string, isDigit func(rune) bool) interface{} {
+	s.advance()
+	ok := s.digits(isDigit, false)
+	if s.isAlpha(s.peek()) || s.isDigit(s.peek()) {
+		return s.invalidNumber(fmt.Sprintf("invalid digit %q in %s literal", s.peek(), name))
+	}
+	if s.current == s.start+2 {
+		return s.invalidNumber("missing " + name + " digits")
+	}
+	if !ok {
+		return s.invalidNumber("'_' must separate successive digits")
+	}
+
+	text := strings.ReplaceAll(s.source[s.start+2:s.current], "_", "")
+	n, _ := new(big.Int).SetString(text, base)
+	return normalizeInt(n)
+}
+
+// digits consumes a run of digits which may contain '_' separators. It
+// reports false when a separator does not sit between two digits.
+func (s *scanner) digits(isDigit func(rune) bool, afterDigit bool) bool {
+	ok := true
+	for {
+		c := s.peek()
+		if isDigit(c) {
+			afterDigit = true
+		} else if c == '_' {
+			if !afterDigit || !isDigit(s.peekNext()) {
+				ok = false
+			}
+			afterDigit = false
+		} else {
+			return ok
+		}
+		s.advance()
+	}
+}
+
+// invalidNumber reports a malformed literal and skips the rest of it so a
+// single mistake produces a single diagnostic.
+func (s *scanner) invalidNumber(msg string) interface{} {
+	for s.isAlpha(s.peek()) || s.isDigit(s.peek()) {
+		s.advance()
+	}
+	s.error(fmt.Sprintf("invalid number %s: %s", s.source[s.start:s.current], msg))
+	return 0.0
+}
+
 func (s *scanner) identifier() Token {
-	for s.isAlpha(s.peek()) {
+	for s.isAlphaNumeric(s.peek()) {
 		s.advance()
 	}
 
@@ -202,15 +503,22 @@ func (s *scanner) identifier() Token {
 
 	// keywords ?
 	if v, ok := KEYWORDS[str]; ok {
-		return NewToken(v, "", nil, s.line)
+		return s.newToken(v, str, nil)
 	}
-	return NewToken(IDENTIFIER, s.source[s.start:s.current], nil, s.line)
+	return s.newToken(IDENTIFIER, str, nil)
+}
+
+// newToken builds a token located at the start of the current lexeme.
+func (s *scanner) newToken(kind TokenKind, lexeme string, literal interface{}) Token {
+	t := NewToken(kind, lexeme, literal, s.startLine)
+	t.pos = s.startPos
+	return t
 }
 
 func (s *scanner) addToken(kind TokenKind) {
-	s.tokens = append(s.tokens, NewToken(kind, s.source[s.start:s.current], nil, s.line))
+	s.tokens = append(s.tokens, s.newToken(kind, s.source[s.start:s.current], nil))
 }
 
 func (s *scanner) addTokenValue(kind TokenKind, v interface{}) {
-	s.tokens = append(s.tokens, NewToken(kind, "", v, s.line))
+	s.tokens = append(s.tokens, s.newToken(kind, s.source[s.start:s.current], v))
 }
@@ -0,0 +1,64 @@
+package core
+
+import "testing"
+
+// scanErrors scans src and returns its diagnostics.
+func scanErrors(src string) []error {
+	s := NewScanner(src)
+	s.scanTokens()
+	return s.errs
+}
+
+// Malformed number literals are reported where they start.
+func TestInvalidNumbers(t *testing.T) {
+	for lit, msg := range map[string]string{
+		"0x":    "invalid number 0x: missing hexadecimal digits",
+		"1__0":  "invalid number 1__0: '_' must separate successive digits",
+		"1_":    "invalid number 1_: '_' must separate successive digits",
+		"0b102": "invalid number 0b102: invalid digit '2' in binary literal",
+		"1e":    "invalid number 1e: missing exponent digits",
+	} {
+		errs := scanErrors("var ok = 1;\nvar x = " + lit + ";")
+		want := msg + " at line 2, column 9"
+		if len(errs) != 1 || errs[0].Error() != want {
+			t.Errorf("%s: got %v, want %q", lit, errs, want)
+		}
+	}
+}
+
+// Columns count code points, so multi-byte characters before an error take
+// one column each.
+func TestRuneColumns(t *testing.T) {
+	for src, want := range map[string]string{
+		`var café = 1; @`:          "invalid char '@' at line 1, column 15",
+		"var s = \"世界👋\";\n名字 # x": "invalid char '#', expect #{ at line 2, column 4",
+		`"é" 0x;`:                  "invalid number 0x: missing hexadecimal digits at line 1, column 5",
+	} {
+		errs := scanErrors(src)
+		if len(errs) != 1 || errs[0].Error() != want {
+			t.Errorf("%q: got %v, want %q", src, errs, want)
+		}
+	}
+}
+
+// Lines keep counting through multi-line strings and comments.
+func TestLinesAfterMultiLineLiterals(t *testing.T) {
+	src := `var poem = """
+    two
+    lines
+    """;
+/* a comment
+   /* nested */
+*/
+var raw = r"""
+    \n
+    """;
+`
+	if errs := scanErrors(src + "@"); len(errs) != 1 || errs[0].Error() != "invalid char '@' at line 11, column 1" {
+		t.Errorf("got %v, want the error at line 11", errs)
+	}
+	err := run(src + "assert poem == raw;")
+	if want := `assert poem == raw failed: "two\nlines" != "\\n" at line 11`; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,265 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// start is where manual clocks of the tests begin.
+var start = time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+
+// scriptOptions configures the scripts of test/ that need the host to set
+// something up.
+func scriptOptions(t *testing.T, name string) []Option {
+	switch name {
+	case "async", "time":
+		return []Option{WithClock(NewManualClock(start))}
+	case "fs":
+		return []Option{WithFS(NewMemFS())}
+	}
+	return nil
+}
+
+// TestScripts runs every script of test/, they check themselves with
+// assert.
+func TestScripts(t *testing.T) {
+	paths, err := filepath.Glob("../../test/*.lox")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no scripts found: %v", err)
+	}
+	for _, path := range paths {
+		path := path
+		name := strings.TrimSuffix(filepath.Base(path), ".lox")
+		t.Run(name, func(t *testing.T) {
+			if err := RunFile(path, scriptOptions(t, name)...); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// A failing timer callback rejects its promise, later timers still fire and
+// the rejection is reported once the loop drains.
+func TestTimerCallbackFailure(t *testing.T) {
+	err := run(`
+fun fail() {
+    assert false, "boom";
+}
+var ran = false;
+fun later() {
+    ran = true;
+}
+setTimeout(fail, 1);
+setTimeout(later, 2);
+await sleep(5);
+assert ran, "later timer didn't fire";
+`, WithClock(NewManualClock(start)))
+	want := "unhandled rejection: assert false failed: boom at line 3"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got error %v, want %q", err, want)
+	}
+}
+
+// The fs script passes on disk too, and links can't lead scripts out of the
+// root.
+func TestDirFS(t *testing.T) {
+	outside := t.TempDir()
+	root := filepath.Join(outside, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunFile("../../test/fs.lox", WithFS(DirFS(root))); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{"up": "..", "dangling": "nowhere", "here": "."} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skip("no symlinks:", err)
+		}
+	}
+	err := run(`
+assert try(fs.read, "up/secret.txt").isErr();
+assert try(fs.write, "up/pwned.txt", "x").isErr();
+assert try(fs.append, "up/pwned.txt", "x").isErr();
+assert try(fs.list, "up").isErr();
+assert try(fs.mkdir, "up/dir").isErr();
+assert try(fs.exists, "up/secret.txt").isErr();
+assert try(fs.write, "dangling", "x").isErr();
+
+// links staying inside the root work, removing one leaves its target
+fs.write("here/inside.txt", "in");
+assert fs.read("inside.txt") == "in";
+fs.remove("up");
+assert !fs.exists("up");
+`, WithFS(DirFS(root)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"pwned.txt", "dir"} {
+		if _, err := os.Lstat(filepath.Join(outside, name)); err == nil {
+			t.Errorf("%s was created outside the root", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "secret.txt")); err != nil {
+		t.Errorf("secret.txt is gone: %v", err)
+	}
+}
+
+// clock() and the time module read the clock the host injects.
+func TestInjectedClock(t *testing.T) {
+	c := NewManualClock(start)
+	err := run(`
+assert clock() == 0;
+assert time.now() == time.date(2024, 2, 29, 12, 0, 0);
+assert time.unix() == 1709208000;
+time.sleep(90);
+assert clock() == 90;
+assert time.now().minute == 1 and time.now().second == 30;
+await sleep(500);
+assert clock() == 90.5;
+`, WithClock(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := start.Add(90500 * time.Millisecond); !c.Now().Equal(want) {
+		t.Fatalf("clock is at %v, want %v", c.Now(), want)
+	}
+}
+
+// draws takes a few values from the random source of an interpreter.
+func draws(i *Interpreter) []float64 {
+	var out []float64
+	for n := 0; n < 5; n++ {
+		out = append(out, i.random.float(), float64(i.random.int63n(1e12)))
+	}
+	for _, idx := range i.random.pick(1000, 3) {
+		out = append(out, float64(idx))
+	}
+	return out
+}
+
+// The same seed repeats the same sequence, another one doesn't.
+func TestRandSeed(t *testing.T) {
+	a := draws(NewInterpreter(WithRandSeed(7)))
+	b := draws(NewInterpreter(WithRandSeed(7)))
+	c := draws(NewInterpreter(WithRandSeed(8)))
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("seed 7 gave %v, then %v", a, b)
+	}
+	if reflect.DeepEqual(a, c) {
+		t.Fatalf("seeds 7 and 8 both gave %v", a)
+	}
+}
+
+// A task that fails with no one awaiting it fails the script, and the
+// script waits for the tasks it spawned.
+func TestUnawaitedTask(t *testing.T) {
+	err := run(`
+fun bad() {
+    assert false;
+}
+var t = spawn bad();
+await sleep(10);
+println("done");
+`)
+	want := "unawaited task failed: assert false failed at line 3"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got error %v, want %q", err, want)
+	}
+
+	// a task still running is waited for, one blocked for good is cancelled
+	files := NewMemFS()
+	err = run(`
+fun slow() {
+    for (i in 0..5000) {}
+    fs.write("slow.txt", "finished");
+}
+var ch = channel(0);
+fun stuck() {
+    ch.recv();
+}
+spawn slow();
+spawn stuck();
+`, WithFS(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := files.ReadFile("slow.txt"); err != nil || string(data) != "finished" {
+		t.Fatalf("slow task didn't finish: %q, %v", data, err)
+	}
+}
+
+// Tasks that all wait for each other fail with a runtime error instead of
+// crashing or hanging the host.
+func TestDeadlock(t *testing.T) {
+	for src, want := range map[string]string{
+		"var ch = channel(0);\nch.recv();": "deadlock: all tasks are blocked at line 2",
+		`var a = channel(0);
+var b = channel(0);
+fun relay() {
+    b.send(a.recv());
+}
+var t = spawn relay();
+await t;`: "deadlock: all tasks are blocked at line 7",
+		`var ch = channel(0);
+select {
+    case v = ch.recv():
+        println(v);
+}`: "deadlock: all tasks are blocked at line 2",
+	} {
+		err := run(src)
+		if err == nil || err.Error() != want {
+			t.Errorf("%q: got error %v, want %q", src, err, want)
+		}
+	}
+}
+
+// meetingFS makes each read wait until the other one started too, so reads
+// done one after another fail.
+type meetingFS struct {
+	*MemFS
+	started sync.WaitGroup
+}
+
+func (m *meetingFS) ReadFile(name string) ([]byte, error) {
+	m.started.Done()
+	met := make(chan struct{})
+	go func() {
+		m.started.Wait()
+		close(met)
+	}()
+	select {
+	case <-met:
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("reads didn't overlap")
+	}
+	return m.MemFS.ReadFile(name)
+}
+
+// Host calls of spawned tasks run at the same time.
+func TestTasksOverlapHostCalls(t *testing.T) {
+	files := &meetingFS{MemFS: NewMemFS()}
+	files.started.Add(2)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := files.WriteFile(name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := run(`
+var a = spawn fs.read("a.txt");
+var b = spawn fs.read("b.txt");
+assert await a == "a.txt";
+assert await b == "b.txt";
+`, WithFS(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Set is a mutable collection of distinct values that remembers insertion
+// order. Elements are compared with hashKey like map keys. Sets are equal
+// when they hold the same elements, in any order, and being mutable they
+// can't be map keys or set elements themselves.
+type Set struct {
+	elems []interface{}
+	keys  []interface{}
+	index map[interface{}]int
+}
+
+func NewSet() *Set {
+	return &Set{index: make(map[interface{}]int)}
+}
+
+// newSet is the set built-in, it collects the elements of an optional
+// iterable.
+func newSet(i *Interpreter, args []interface{}) interface{} {
+	checkArgc(args, 0, 1, "set")
+	s := NewSet()
+	if len(args) == 1 {
+		s.addAll(args[0], "set")
+	}
+	return s
+}
+
+func (i *Interpreter) evaluateSetLiteralExpr(v SetLiteralExpr) interface{} {
+	s := NewSet()
+	for _, e := range v.elems {
+		value := i.interpret(e)
+		s.insert(value, hashKey(value, v.brace))
+	}
+	return s
+}
+
+func (s *Set) String() string {
+	items := make([]string, len(s.elems))
+	for idx, e := range s.elems {
+		items[idx] = repr(e)
+	}
+	return "#{" + strings.Join(items, ", ") + "}"
+}
+
+// iterator walks a snapshot, so the set may change during the loop.
+func (s *Set) iterator() iterator {
+	elems := make([]interface{}, len(s.elems))
+	copy(elems, s.elems)
+	return indexIterator(len(elems), func(idx int) interface{} {
+		return elems[idx]
+	})
+}
+
+func (s *Set) has(key interface{}) bool {
+	_, ok := s.index[key]
+	return ok
+}
+
+func (s *Set) insert(v, key interface{}) {
+	if s.has(key) {
+		return
+	}
+	s.index[key] = len(s.elems)
+	s.elems = append(s.elems, v)
+	s.keys = append(s.keys, key)
+}
+
+// delete removes the element with the given key, reporting whether it was
+// there.
+func (s *Set) delete(key interface{}) bool {
+	idx, ok := s.index[key]
+	if !ok {
+		return false
+	}
+	delete(s.index, key)
+	s.elems = append(s.elems[:idx], s.elems[idx+1:]...)
+	s.keys = append(s.keys[:idx], s.keys[idx+1:]...)
+	for n := idx; n < len(s.keys); n++ {
+		s.index[s.keys[n]] = n
+	}
+	return true
+}
+
+// addAll inserts every element of the iterable v.
+func (s *Set) addAll(v interface{}, fn string) {
+	if _, ok := v.(string); !ok {
+		if _, ok := v.(iterable); !ok {
+			panic(nativeErr(fmt.Sprintf("%s: expect an iterable, got %s", fn, repr(v))))
+		}
+	}
+	it := iterate(v, Token{})
+	for {
+		e, ok := it.next()
+		if !ok {
+			return
+		}
+		s.insert(e, nativeHashKey(e))
+	}
+}
+
+// toSet returns v when it is a set, else a set of its elements.
+func toSet(v interface{}, fn string) *Set {
+	if s, ok := v.(*Set); ok {
+		return s
+	}
+	s := NewSet()
+	s.addAll(v, fn)
+	return s
+}
+
+func (s *Set) get(name Token) interface{} {
+	switch name.lexeme {
+	case "add":
+		return &nativeFunc{name: "add", argc: 1, fn: s.add}
+	case "remove":
+		return &nativeFunc{name: "remove", argc: 1, fn: s.remove}
+	case "contains":
+		return &nativeFunc{name: "contains", argc: 1, fn: s.contains}
+	case "union":
+		return &nativeFunc{name: "union", argc: 1, fn: s.union}
+	case "intersection":
+		return &nativeFunc{name: "intersection", argc: 1, fn: s.intersection}
+	case "difference":
+		return &nativeFunc{name: "difference", argc: 1, fn: s.difference}
+	case "isSubset":
+		return &nativeFunc{name: "isSubset", argc: 1, fn: s.isSubset}
+	case "isSuperset":
+		return &nativeFunc{name: "isSuperset", argc: 1, fn: s.isSuperset}
+	}
+	panic(NewRuntimeErr(name, "set has no property '%s'", name.lexeme))
+}
+
+func (s *Set) add(i *Interpreter, args []interface{}) interface{} {
+	s.insert(args[0], nativeHashKey(args[0]))
+	return nil
+}
+
+// remove reports whether the value was in the set.
+func (s *Set) remove(i *Interpreter, args []interface{}) interface{} {
+	return s.delete(nativeHashKey(args[0]))
+}
+
+func (s *Set) contains(i *Interpreter, args []interface{}) interface{} {
+	return s.has(nativeHashKey(args[0]))
+}
+
+// union, intersection and difference return a new set and accept any
+// iterable.
+func (s *Set) union(i *Interpreter, args []interface{}) interface{} {
+	result := NewSet()
+	result.addAll(s, "union")
+	result.addAll(args[0], "union")
+	return result
+}
+
+func (s *Set) intersection(i *Interpreter, args []interface{}) interface{} {
+	other := toSet(args[0], "intersection")
+	result := NewSet()
+	for idx, key := range s.keys {
+		if other.has(key) {
+			result.insert(s.elems[idx], key)
+		}
+	}
+	return result
+}
+
+func (s *Set) difference(i *Interpreter, args []interface{}) interface{} {
+	other := toSet(args[0], "difference")
+	result := NewSet()
+	for idx, key := range s.keys {
+		if !other.has(key) {
+			result.insert(s.elems[idx], key)
+		}
+	}
+	return result
+}
+
+func (s *Set) isSubset(i *Interpreter, args []interface{}) interface{} {
+	return subset(s, toSet(args[0], "isSubset"))
+}
+
+func (s *Set) isSuperset(i *Interpreter, args []interface{}) interface{} {
+	return subset(toSet(args[0], "isSuperset"), s)
+}
+
+func subset(a, b *Set) bool {
+	for _, key := range a.keys {
+		if !b.has(key) {
+			return false
+		}
+	}
+	return true
+}
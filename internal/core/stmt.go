@@ -26,11 +26,94 @@ type WhileStmt struct {
 	body      Stmt
 }
 
+// DoWhileStmt is `do body while (condition);`, it checks condition after
+// each run of body.
+type DoWhileStmt struct {
+	body      Stmt
+	condition Expr
+}
+
+// ForInStmt is `for (name in iterable) body`. With two names each element
+// is unpacked, e.g. `for (k, v in map)`.
+type ForInStmt struct {
+	names    []Token
+	iterable Expr
+	body     Stmt
+}
+
+// SwitchStmt runs the first case with a value equal to subject, or the
+// default case when none matches. Cases don't fall through unless they end
+// with `fallthrough`.
+type SwitchStmt struct {
+	keyword Token
+	subject Expr
+	cases   []SwitchCase
+}
+
+// SwitchCase is `case a, b:` or `default:`, values is empty for default.
+// falls is set when the case ends with `fallthrough`.
+type SwitchCase struct {
+	keyword Token
+	values  []Expr
+	body    []Stmt
+	falls   bool
+}
+
+// BreakStmt leaves the innermost loop or switch. A select is not a target,
+// so break inside a select leaves the loop around it.
+type BreakStmt struct {
+	keyword Token
+}
+
+// RecordStmt is `record Name(field, ...);`.
+type RecordStmt struct {
+	name   Token
+	fields []Token
+}
+
 type FuncStmt struct {
 	name    Token
 	params  []Token
 	body    []Stmt
 	closure *Env
+	// async functions return a promise and run on the event loop
+	async bool
+	// doc is the string literal the body started with, if any
+	doc string
+}
+
+// DeferStmt is `defer call;`. The callee and arguments are evaluated
+// right away, the call runs when the enclosing function returns.
+type DeferStmt struct {
+	keyword Token
+	call    CallExpr
+}
+
+// AssertStmt is `assert expr, message;`, source keeps the text of expr for
+// the failure report.
+type AssertStmt struct {
+	keyword Token
+	expr    Expr
+	message Expr
+	source  string
+}
+
+// SelectStmt waits until one of its cases can proceed, like Go's select.
+type SelectStmt struct {
+	keyword Token
+	cases   []SelectCase
+}
+
+// SelectCase is `case name = channel.recv():`, where `name =` is optional,
+// `case channel.send(value):` or `default:`.
+type SelectCase struct {
+	keyword   Token
+	isDefault bool
+	name      *Token
+	channel   Expr
+	send      bool
+	value     Expr
+	body      []Stmt
 }
 
 type ReturnStmt struct {
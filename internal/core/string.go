@@ -0,0 +1,228 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// stringMethod returns the method name of the string s, bound to s.
+// Lengths and indexes count code points, like len and indexing do.
+func stringMethod(s string, name Token) interface{} {
+	bind := func(argc int, fn func(s string, args []interface{}) interface{}) *nativeFunc {
+		return &nativeFunc{
+			name: name.lexeme,
+			argc: argc,
+			fn: func(i *Interpreter, args []interface{}) interface{} {
+				return fn(s, args)
+			},
+		}
+	}
+
+	switch name.lexeme {
+	case "len":
+		return bind(0, func(s string, args []interface{}) interface{} {
+			return float64(utf8.RuneCountInString(s))
+		})
+	case "upper":
+		return bind(0, func(s string, args []interface{}) interface{} {
+			return strings.ToUpper(s)
+		})
+	case "lower":
+		return bind(0, func(s string, args []interface{}) interface{} {
+			return strings.ToLower(s)
+		})
+	case "trim":
+		return bind(variadic, strTrim)
+	case "split":
+		return bind(variadic, strSplit)
+	case "join":
+		return bind(1, strJoin)
+	case "replace":
+		return bind(2, func(s string, args []interface{}) interface{} {
+			return strings.ReplaceAll(s, stringArg(args[0], "replace"), stringArg(args[1], "replace"))
+		})
+	case "contains":
+		return bind(1, func(s string, args []interface{}) interface{} {
+			return strings.Contains(s, stringArg(args[0], "contains"))
+		})
+	case "startsWith":
+		return bind(1, func(s string, args []interface{}) interface{} {
+			return strings.HasPrefix(s, stringArg(args[0], "startsWith"))
+		})
+	case "endsWith":
+		return bind(1, func(s string, args []interface{}) interface{} {
+			return strings.HasSuffix(s, stringArg(args[0], "endsWith"))
+		})
+	case "indexOf":
+		return bind(1, strIndexOf)
+	case "repeat":
+		return bind(1, func(s string, args []interface{}) interface{} {
+			n := countArg(args[0], "repeat")
+			checkLength(len(s), n, "repeat")
+			return strings.Repeat(s, n)
+		})
+	case "padLeft":
+		return bind(variadic, strPadLeft)
+	case "chars":
+		return bind(0, func(s string, args []interface{}) interface{} {
+			var chars []interface{}
+			for _, r := range s {
+				chars = append(chars, string(r))
+			}
+			return NewList(chars)
+		})
+	case "format":
+		return bind(variadic, strFormat)
+	}
+	panic(NewRuntimeErr(name, "string has no method '%s'", name.lexeme))
+}
+
+// strTrim removes leading and trailing white space, or the characters of
+// its optional argument.
+func strTrim(s string, args []interface{}) interface{} {
+	checkArgc(args, 0, 1, "trim")
+	if len(args) == 1 {
+		return strings.Trim(s, stringArg(args[0], "trim"))
+	}
+	return strings.TrimSpace(s)
+}
+
+// strSplit splits around a separator, or around runs of white space when
+// there is none.
+func strSplit(s string, args []interface{}) interface{} {
+	checkArgc(args, 0, 1, "split")
+	var parts []string
+	if len(args) == 1 {
+		parts = strings.Split(s, stringArg(args[0], "split"))
+	} else {
+		parts = strings.Fields(s)
+	}
+	elems := make([]interface{}, len(parts))
+	for idx, p := range parts {
+		elems[idx] = p
+	}
+	return NewList(elems)
+}
+
+// strJoin joins the strings of an iterable with s between them.
+func strJoin(s string, args []interface{}) interface{} {
+	var parts []string
+	for _, v := range collect(args[0], "join") {
+		parts = append(parts, stringArg(v, "join"))
+	}
+	return strings.Join(parts, s)
+}
+
+// strIndexOf returns the code point index of the first occurrence of its
+// argument, or -1.
+func strIndexOf(s string, args []interface{}) interface{} {
+	idx := strings.Index(s, stringArg(args[0], "indexOf"))
+	if idx < 0 {
+		return float64(-1)
+	}
+	return float64(utf8.RuneCountInString(s[:idx]))
+}
+
+// strPadLeft pads s to width code points with spaces, or with the single
+// character given as second argument.
+func strPadLeft(s string, args []interface{}) interface{} {
+	checkArgc(args, 1, 2, "padLeft")
+	width := countArg(args[0], "padLeft")
+	fill := " "
+	if len(args) == 2 {
+		fill = stringArg(args[1], "padLeft")
+		if utf8.RuneCountInString(fill) != 1 {
+			panic(nativeErr("padLeft: fill must be a single character, got " + repr(args[1])))
+		}
+	}
+	if n := width - utf8.RuneCountInString(s); n > 0 {
+		checkLength(len(fill), n, "padLeft")
+		return strings.Repeat(fill, n) + s
+	}
+	return s
+}
+
+// strFormat replaces {} with the next argument and {n} with argument n.
+// {{ and }} stand for literal braces.
+func strFormat(s string, args []interface{}) interface{} {
+	var b strings.Builder
+	next := 0
+	for idx := 0; idx < len(s); idx++ {
+		c := s[idx]
+		switch {
+		case (c == '{' || c == '}') && idx+1 < len(s) && s[idx+1] == c:
+			b.WriteByte(c)
+			idx++
+		case c == '{':
+			end := strings.IndexByte(s[idx:], '}')
+			if end < 0 {
+				panic(nativeErr("format: unclosed { in " + repr(s)))
+			}
+			field := s[idx+1 : idx+end]
+			n := next
+			if field == "" {
+				next++
+			} else {
+				var err error
+				if n, err = strconv.Atoi(field); err != nil {
+					panic(nativeErr(fmt.Sprintf("format: invalid field {%s}", field)))
+				}
+			}
+			if n < 0 || n >= len(args) {
+				panic(nativeErr(fmt.Sprintf("format: missing argument %d, got %d arguments", n, len(args))))
+			}
+			b.WriteString(stringify(args[n]))
+			idx += end
+		case c == '}':
+			panic(nativeErr("format: single } in " + repr(s)))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// stringify formats v as println shows it, strings are not quoted.
+func stringify(v interface{}) string {
+	if v == nil {
+		return "nil"
+	}
+	return fmt.Sprint(v)
+}
+
+func stringArg(v interface{}, fn string) string {
+	s, ok := v.(string)
+	if !ok {
+		panic(nativeErr(fmt.Sprintf("%s: expect a string, got %s", fn, repr(v))))
+	}
+	return s
+}
+
+// maxStringLen bounds the strings natives build, in bytes.
+const maxStringLen = 1 << 30
+
+// checkLength fails when n copies of size bytes would pass maxStringLen.
+func checkLength(size, n int, fn string) {
+	if size > 0 && n > maxStringLen/size {
+		panic(nativeErr(fmt.Sprintf("%s: result of %d x %d bytes is too long", fn, n, size)))
+	}
+}
+
+// countArg checks for a non-negative integer that fits an int.
+func countArg(v interface{}, fn string) int {
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) || f >= math.MaxInt64 {
+		panic(nativeErr(fmt.Sprintf("%s: expect a non-negative integer, got %s", fn, repr(v))))
+	}
+	return int(f)
+}
+
+// checkArgc checks the argument count of natives with optional arguments.
+func checkArgc(args []interface{}, min, max int, fn string) {
+	if len(args) < min || len(args) > max {
+		panic(nativeErr(fmt.Sprintf("%s: expect %d to %d arguments, got %d", fn, min, max, len(args))))
+	}
+}
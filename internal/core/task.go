@@ -0,0 +1,300 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+)
+
+// Task is the handle of a call started with spawn.
+type Task struct {
+	done  chan struct{}
+	value interface{}
+	err   interface{}
+	// awaited is set once some task waits for the result, a failure no one
+	// awaited is reported when the script ends.
+	awaited bool
+}
+
+// taskCancel unwinds a task still blocked on a channel once the script is
+// over.
+type taskCancel struct{}
+
+func (t *Task) String() string {
+	return "<task>"
+}
+
+func (t *Task) get(name Token) interface{} {
+	if name.lexeme == "done" {
+		select {
+		case <-t.done:
+			return true
+		default:
+			return false
+		}
+	}
+	panic(NewRuntimeErr(name, "task has no property '%s'", name.lexeme))
+}
+
+// wait blocks until the task finishes and returns its result, raising the
+// error that killed it if any. A deadlock is reported at keyword.
+func (t *Task) wait(i *Interpreter, keyword Token) interface{} {
+	t.awaited = true
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				if msg, ok := r.(nativeErr); ok {
+					panic(NewRuntimeErr(keyword, "%s", msg))
+				}
+				panic(r)
+			}
+		}()
+		i.loop.park([]reflect.SelectCase{recvCase(t.done)})
+	}()
+	if t.err != nil {
+		panic(t.err)
+	}
+	return t.value
+}
+
+// evaluateSpawnExpr evaluates the callee and arguments right away, then runs
+// the call with a forked interpreter so every task keeps its own call state.
+// The task starts once the spawning one blocks or lets it take a turn.
+func (i *Interpreter) evaluateSpawnExpr(v SpawnExpr) interface{} {
+	fn, args := i.prepareCall(v.call)
+	t := &Task{done: make(chan struct{})}
+	child := i.fork()
+	i.tasks.add(t)
+	i.loop.taskStarted()
+	go func() {
+		child.loop.gil.Lock()
+		defer child.loop.gil.Unlock()
+		defer func() {
+			if r := recover(); r != nil {
+				t.err = r
+			}
+			child.tasks.remove(t)
+			child.loop.taskEnded()
+			close(t.done)
+		}()
+		t.value = child.call(fn, args, v.call.paren)
+	}()
+	return t
+}
+
+func (i *Interpreter) evaluateAwaitExpr(v AwaitExpr) interface{} {
+	value := i.interpret(v.value)
+	switch t := value.(type) {
+	case *Task:
+		if i.co != nil && i.co.async {
+			return i.await(i.loop.watch(t))
+		}
+		return t.wait(i, v.keyword)
+	case *Promise:
+		return i.await(t)
+	}
+	panic(NewRuntimeErr(v.keyword, "can't await %s", repr(value)))
+}
+
+// checkpoint lets other tasks take a turn every so many loop iterations, so
+// a busy loop can't starve them.
+func (i *Interpreter) checkpoint() {
+	i.ticks++
+	if i.ticks%1024 == 0 {
+		i.loop.blocking(runtime.Gosched)
+	}
+}
+
+// Channel passes values between tasks, it is backed by a Go channel.
+type Channel struct {
+	ch   chan interface{}
+	loop *eventLoop
+}
+
+func newChannel(i *Interpreter, args []interface{}) interface{} {
+	n, ok := args[0].(float64)
+	if !ok || n < 0 || n != float64(int(n)) {
+		panic(nativeErr("channel: expect a buffer size, got " + repr(args[0])))
+	}
+	return &Channel{ch: make(chan interface{}, int(n)), loop: i.loop}
+}
+
+func (c *Channel) String() string {
+	return fmt.Sprintf("<channel %d/%d>", len(c.ch), cap(c.ch))
+}
+
+func (c *Channel) get(name Token) interface{} {
+	switch name.lexeme {
+	case "send":
+		return &nativeFunc{name: "send", argc: 1, fn: c.send}
+	case "recv":
+		return &nativeFunc{name: "recv", argc: 0, fn: c.recv}
+	case "close":
+		return &nativeFunc{name: "close", argc: 0, fn: c.close}
+	}
+	panic(NewRuntimeErr(name, "channel has no property '%s'", name.lexeme))
+}
+
+func (c *Channel) send(i *Interpreter, args []interface{}) interface{} {
+	defer recoverClosed("send on closed channel")
+	c.loop.park([]reflect.SelectCase{{
+		Dir:  reflect.SelectSend,
+		Chan: reflect.ValueOf(c.ch),
+		Send: reflect.ValueOf(&args[0]).Elem(),
+	}})
+	return nil
+}
+
+// recv returns the next value, or nil once the channel is closed and
+// drained.
+func (c *Channel) recv(i *Interpreter, args []interface{}) interface{} {
+	v, _ := c.receive()
+	return v
+}
+
+func (c *Channel) receive() (interface{}, bool) {
+	_, value, ok := c.loop.park([]reflect.SelectCase{recvCase(c.ch)})
+	if !ok {
+		return nil, false
+	}
+	return value.Interface(), true
+}
+
+func (c *Channel) close(i *Interpreter, args []interface{}) interface{} {
+	defer recoverClosed("close of closed channel")
+	close(c.ch)
+	return nil
+}
+
+// iterator receives until the channel is closed.
+func (c *Channel) iterator() iterator {
+	return iteratorFunc(c.receive)
+}
+
+// recoverClosed turns the Go panic of misusing a closed channel into an
+// error of the script.
+func recoverClosed(msg string) {
+	if r := recover(); r != nil {
+		if _, ok := r.(runtime.Error); !ok {
+			panic(r)
+		}
+		panic(nativeErr(msg))
+	}
+}
+
+func (i *Interpreter) evaluateSelectStmt(v SelectStmt) interface{} {
+	cases := make([]reflect.SelectCase, len(v.cases))
+	for idx, c := range v.cases {
+		if c.isDefault {
+			cases[idx] = reflect.SelectCase{Dir: reflect.SelectDefault}
+			continue
+		}
+
+		object := i.interpret(c.channel)
+		ch, ok := object.(*Channel)
+		if !ok {
+			panic(NewRuntimeErr(c.keyword, "can't select on %s", repr(object)))
+		}
+		cases[idx] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.ch)}
+		if c.send {
+			value := i.interpret(c.value)
+			cases[idx].Dir = reflect.SelectSend
+			cases[idx].Send = reflect.ValueOf(&value).Elem()
+		}
+	}
+
+	chosen, received := i.selectCase(v, cases)
+	c := v.cases[chosen]
+	env := NewEnv(i.globals)
+	if c.name != nil {
+		env.define(c.name.lexeme, received)
+	}
+	return i.evaluateBlockStmt(BlockStmt{stmts: c.body}, env)
+}
+
+func (i *Interpreter) selectCase(v SelectStmt, cases []reflect.SelectCase) (chosen int, received interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case runtime.Error:
+				panic(NewRuntimeErr(v.keyword, "send on closed channel"))
+			case nativeErr:
+				panic(NewRuntimeErr(v.keyword, "%s", r))
+			}
+			panic(r)
+		}
+	}()
+	chosen, value, ok := i.loop.park(cases)
+	if ok {
+		received = value.Interface()
+	}
+	return chosen, received
+}
+
+// taskSet holds the spawned tasks of an interpreter that haven't finished,
+// and the failed ones, so the script waits for them and reports their
+// errors when it ends.
+type taskSet struct {
+	mu     sync.Mutex
+	live   map[*Task]bool
+	failed []*Task
+}
+
+func newTaskSet() *taskSet {
+	return &taskSet{live: make(map[*Task]bool)}
+}
+
+func (s *taskSet) add(t *Task) {
+	s.mu.Lock()
+	s.live[t] = true
+	s.mu.Unlock()
+}
+
+func (s *taskSet) remove(t *Task) {
+	s.mu.Lock()
+	delete(s.live, t)
+	if t.err != nil {
+		s.failed = append(s.failed, t)
+	}
+	s.mu.Unlock()
+}
+
+// finish waits for the tasks still running once the script is over. Tasks
+// blocked on a channel are cancelled, nothing will ever be sent to or
+// received from them. It returns the first failure no one awaited.
+func (s *taskSet) finish(i *Interpreter) interface{} {
+	i.loop.stop()
+	for {
+		s.mu.Lock()
+		var t *Task
+		for t = range s.live {
+			break
+		}
+		s.mu.Unlock()
+		if t == nil {
+			break
+		}
+		i.loop.blocking(func() {
+			<-t.done
+		})
+	}
+
+	for _, t := range s.failed {
+		if _, ok := t.err.(taskCancel); !ok && !t.awaited {
+			return unhandledTaskErr(t.err)
+		}
+	}
+	return nil
+}
+
+// unhandledTaskErr marks err as the failure of a task no one awaited.
+func unhandledTaskErr(err interface{}) interface{} {
+	switch err := err.(type) {
+	case RuntimeErr:
+		return NewRuntimeErr(err.token, "unawaited task failed: %s", err.msg)
+	case nativeErr:
+		return nativeErr("unawaited task failed: " + string(err))
+	}
+	return err
+}
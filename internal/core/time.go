@@ -0,0 +1,199 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"time"
+	// zones resolve even where the system has no zone database
+	_ "time/tzdata"
+)
+
+// DateTime is an instant in a time zone, made by the time module. Durations
+// are numbers of seconds.
+type DateTime struct {
+	t time.Time
+}
+
+type timeTag struct{}
+
+func (d *DateTime) String() string {
+	return d.t.Format(time.RFC3339Nano)
+}
+
+// get returns a date component or a method of d.
+func (d *DateTime) get(name Token) interface{} {
+	t := d.t
+	switch name.lexeme {
+	case "year":
+		return float64(t.Year())
+	case "month":
+		return float64(t.Month())
+	case "day":
+		return float64(t.Day())
+	case "hour":
+		return float64(t.Hour())
+	case "minute":
+		return float64(t.Minute())
+	case "second":
+		return float64(t.Second())
+	case "nanosecond":
+		return float64(t.Nanosecond())
+	case "weekday":
+		// 0 is Sunday
+		return float64(t.Weekday())
+	case "yearDay":
+		return float64(t.YearDay())
+	case "zone":
+		zone, _ := t.Zone()
+		return zone
+	case "offset":
+		_, offset := t.Zone()
+		return float64(offset)
+	case "format":
+		return &nativeFunc{name: "format", argc: 1, fn: func(i *Interpreter, args []interface{}) interface{} {
+			return t.Format(stringArg(args[0], "format"))
+		}}
+	case "inZone":
+		return &nativeFunc{name: "inZone", argc: 1, fn: func(i *Interpreter, args []interface{}) interface{} {
+			return &DateTime{t: t.In(zoneArg(args[0], "inZone"))}
+		}}
+	case "add":
+		return &nativeFunc{name: "add", argc: 1, fn: func(i *Interpreter, args []interface{}) interface{} {
+			return &DateTime{t: t.Add(secondsArg(args[0], "add"))}
+		}}
+	case "sub":
+		return &nativeFunc{name: "sub", argc: 1, fn: func(i *Interpreter, args []interface{}) interface{} {
+			return t.Sub(timeArg(args[0], "sub")).Seconds()
+		}}
+	case "unix":
+		return &nativeFunc{name: "unix", argc: 0, fn: func(i *Interpreter, args []interface{}) interface{} {
+			return unixSeconds(t)
+		}}
+	case "before":
+		return &nativeFunc{name: "before", argc: 1, fn: func(i *Interpreter, args []interface{}) interface{} {
+			return t.Before(timeArg(args[0], "before"))
+		}}
+	case "after":
+		return &nativeFunc{name: "after", argc: 1, fn: func(i *Interpreter, args []interface{}) interface{} {
+			return t.After(timeArg(args[0], "after"))
+		}}
+	}
+	panic(NewRuntimeErr(name, "time has no property '%s'", name.lexeme))
+}
+
+func newTimeModule() *Module {
+	m := NewModule("time")
+	// layouts use Go's reference time Mon Jan 2 15:04:05 MST 2006 and
+	// share its names
+	m.members["RFC3339"] = time.RFC3339
+	m.members["RFC1123"] = time.RFC1123
+	m.members["Kitchen"] = time.Kitchen
+	m.members["DateOnly"] = "2006-01-02"
+	m.members["DateTime"] = "2006-01-02 15:04:05"
+
+	m.define("now", 0, func(i *Interpreter, args []interface{}) interface{} {
+		return &DateTime{t: i.loop.clock.Now()}
+	})
+	m.define("unix", 0, func(i *Interpreter, args []interface{}) interface{} {
+		return unixSeconds(i.loop.clock.Now())
+	})
+	m.define("fromUnix", 1, func(i *Interpreter, args []interface{}) interface{} {
+		secs := numberArg(args[0], "time.fromUnix")
+		if math.IsNaN(secs) || secs < math.MinInt64 || secs >= math.MaxInt64 {
+			panic(nativeErr(fmt.Sprintf("time.fromUnix: %v out of range", secs)))
+		}
+		whole := math.Floor(secs)
+		return &DateTime{t: time.Unix(int64(whole), int64((secs-whole)*float64(time.Second))).UTC()}
+	})
+	m.define("date", variadic, timeDate)
+	m.define("parse", variadic, timeParse)
+	m.define("since", 1, func(i *Interpreter, args []interface{}) interface{} {
+		return i.loop.clock.Now().Sub(timeArg(args[0], "time.since")).Seconds()
+	})
+	m.define("duration", 1, func(i *Interpreter, args []interface{}) interface{} {
+		d, err := time.ParseDuration(stringArg(args[0], "time.duration"))
+		if err != nil {
+			panic(nativeErr("time.duration: " + err.Error()))
+		}
+		return d.Seconds()
+	})
+	m.define("formatDuration", 1, func(i *Interpreter, args []interface{}) interface{} {
+		return secondsArg(args[0], "time.formatDuration").String()
+	})
+	// sleep blocks for the given seconds like every duration of the module.
+	// The sleep built-in takes milliseconds like setTimeout and returns a
+	// promise instead.
+	m.define("sleep", 1, func(i *Interpreter, args []interface{}) interface{} {
+		d := secondsArg(args[0], "time.sleep")
+		if d < 0 {
+			panic(nativeErr("time.sleep: negative duration"))
+		}
+		i.loop.blocking(func() {
+			i.loop.clock.Sleep(d)
+		})
+		return nil
+	})
+	return m
+}
+
+// timeDate is time.date(year, month, day, hour, minute, second), the time
+// of day is optional and the zone is UTC.
+func timeDate(i *Interpreter, args []interface{}) interface{} {
+	checkArgc(args, 3, 6, "time.date")
+	var parts [6]int
+	for idx, a := range args {
+		parts[idx] = integerArg(a, "time.date")
+	}
+	t := time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, time.UTC)
+	return &DateTime{t: t}
+}
+
+// timeParse is time.parse(layout, text, zone), the zone applies when text
+// names none and defaults to UTC.
+func timeParse(i *Interpreter, args []interface{}) interface{} {
+	checkArgc(args, 2, 3, "time.parse")
+	loc := time.UTC
+	if len(args) == 3 {
+		loc = zoneArg(args[2], "time.parse")
+	}
+	t, err := time.ParseInLocation(stringArg(args[0], "time.parse"), stringArg(args[1], "time.parse"), loc)
+	if err != nil {
+		panic(nativeErr("time.parse: " + err.Error()))
+	}
+	return &DateTime{t: t}
+}
+
+// unixSeconds doesn't go through UnixNano, which overflows past 2262.
+func unixSeconds(t time.Time) float64 {
+	return float64(t.Unix()) + float64(t.Nanosecond())/float64(time.Second)
+}
+
+func timeArg(v interface{}, fn string) time.Time {
+	d, ok := v.(*DateTime)
+	if !ok {
+		panic(nativeErr(fmt.Sprintf("%s: expect a time, got %s", fn, repr(v))))
+	}
+	return d.t
+}
+
+func secondsArg(v interface{}, fn string) time.Duration {
+	return durationOf(numberArg(v, fn), time.Second, fn)
+}
+
+// durationOf converts n units to a Duration, rejecting what doesn't fit in
+// one instead of wrapping around.
+func durationOf(n float64, unit time.Duration, fn string) time.Duration {
+	d := n * float64(unit)
+	if math.IsNaN(d) || d < math.MinInt64 || d >= math.MaxInt64 {
+		panic(nativeErr(fmt.Sprintf("%s: duration %v out of range", fn, n)))
+	}
+	return time.Duration(d)
+}
+
+func zoneArg(v interface{}, fn string) *time.Location {
+	loc, err := time.LoadLocation(stringArg(v, fn))
+	if err != nil {
+		panic(nativeErr(fmt.Sprintf("%s: unknown time zone %s", fn, repr(v))))
+	}
+	return loc
+}
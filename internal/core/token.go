@@ -5,6 +5,16 @@ type Token struct {
 	lexeme  string
 	literal interface{}
 	line    int
+	pos     Position
+}
+
+// Position locates a token in the source. offset is the byte offset of its
+// first character, col and byteCol are 1-based columns within its line
+// counted in runes and in bytes.
+type Position struct {
+	offset  int
+	col     int
+	byteCol int
 }
 
 func NewToken(kind TokenKind, lexeme string, literal interface{}, line int) Token {
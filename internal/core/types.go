@@ -8,6 +8,10 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
+	COLON
+	QUESTION
 	COMMA
 	DOT
 	MINUS
@@ -25,6 +29,10 @@ const (
 	GREATER_EQUAL
 	LESS
 	LESS_EQUAL
+	DOT_DOT
+	DOT_DOT_EQUAL
+	PIPE_GREATER
+	HASH_LEFT_BRACE
 
 	// literals
 	IDENTIFIER
@@ -33,17 +41,32 @@ const (
 
 	// keywords
 	AND
+	ASSERT
+	ASYNC
+	AWAIT
+	BREAK
+	CASE
 	CLASS
+	DEFAULT
+	DEFER
+	DO
 	ELSE
+	FALLTHROUGH
 	FALSE
 	FUN
 	FOR
 	IF
+	IN
+	LOOP
 	NIL
 	OR
 	PRINT
+	RECORD
 	RETURN
+	SELECT
+	SPAWN
 	SUPER
+	SWITCH
 	THIS
 	TRUE
 	VAR
@@ -53,18 +76,33 @@ const (
 )
 
 var KEYWORDS = map[string]TokenKind{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"fun":    FUN,
-	"for":    FOR,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
+	"and":         AND,
+	"assert":      ASSERT,
+	"async":       ASYNC,
+	"await":       AWAIT,
+	"break":       BREAK,
+	"case":        CASE,
+	"class":       CLASS,
+	"default":     DEFAULT,
+	"defer":       DEFER,
+	"do":          DO,
+	"else":        ELSE,
+	"fallthrough": FALLTHROUGH,
+	"false":       FALSE,
+	"fun":         FUN,
+	"for":         FOR,
+	"if":          IF,
+	"in":          IN,
+	"loop":        LOOP,
+	"nil":         NIL,
+	"or":          OR,
 	// "print":  PRINT,
+	"record": RECORD,
 	"return": RETURN,
+	"select": SELECT,
+	"spawn":  SPAWN,
 	"super":  SUPER,
+	"switch": SWITCH,
 	"this":   THIS,
 	"true":   TRUE,
 	"var":    VAR,
@@ -0,0 +1,389 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// List is a mutable sequence, shared by reference.
+type List struct {
+	elems []interface{}
+}
+
+func NewList(elems []interface{}) *List {
+	return &List{elems: elems}
+}
+
+func (l *List) String() string {
+	items := make([]string, len(l.elems))
+	for idx, e := range l.elems {
+		items[idx] = repr(e)
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+func (l *List) iterator() iterator {
+	idx := 0
+	return iteratorFunc(func() (interface{}, bool) {
+		if idx >= len(l.elems) {
+			return nil, false
+		}
+		idx += 1
+		return l.elems[idx-1], true
+	})
+}
+
+// Map is a hash map that remembers insertion order, shared by reference.
+// Keys are compared with hashKey.
+type Map struct {
+	entries []mapEntry
+	index   map[interface{}]int
+}
+
+type mapEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+func NewMap() *Map {
+	return &Map{index: make(map[interface{}]int)}
+}
+
+func (m *Map) get(key interface{}, t Token) (interface{}, bool) {
+	if idx, ok := m.index[hashKey(key, t)]; ok {
+		return m.entries[idx].value, true
+	}
+	return nil, false
+}
+
+func (m *Map) set(key, value interface{}, t Token) {
+	k := hashKey(key, t)
+	if idx, ok := m.index[k]; ok {
+		m.entries[idx].value = value
+		return
+	}
+	m.index[k] = len(m.entries)
+	m.entries = append(m.entries, mapEntry{key: key, value: value})
+}
+
+func (m *Map) String() string {
+	items := make([]string, len(m.entries))
+	for idx, e := range m.entries {
+		items[idx] = repr(e.key) + ": " + repr(e.value)
+	}
+	return "{" + strings.Join(items, ", ") + "}"
+}
+
+// iterator yields the keys of the map.
+func (m *Map) iterator() iterator {
+	return indexIterator(len(m.entries), func(idx int) interface{} {
+		return m.entries[idx].key
+	})
+}
+
+// pairs yields [key, value] lists.
+func (m *Map) pairs() iterator {
+	return indexIterator(len(m.entries), func(idx int) interface{} {
+		return NewList([]interface{}{m.entries[idx].key, m.entries[idx].value})
+	})
+}
+
+// hashKey maps a value to a comparable Go value such that equal values
+// share a key. Lists and maps are keyed by identity, sets are unhashable.
+func hashKey(v interface{}, t Token) interface{} {
+	k, ok := hashable(v)
+	if !ok {
+		panic(NewRuntimeErr(t, "unhashable value %s", repr(v)))
+	}
+	return k
+}
+
+// nativeHashKey is hashKey for native functions.
+func nativeHashKey(v interface{}) interface{} {
+	k, ok := hashable(v)
+	if !ok {
+		panic(nativeErr("unhashable value " + repr(v)))
+	}
+	return k
+}
+
+func hashable(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case *Tuple:
+		return newCompositeKey(tupleTag{}, v.elems)
+	case *Record:
+		return newCompositeKey(v.typ, v.values)
+	case *Result:
+		return newCompositeKey(resultTag{ok: v.ok}, []interface{}{v.value})
+	case *Maybe:
+		return newCompositeKey(optionTag{some: v.some}, []interface{}{v.value})
+	case *DateTime:
+		// equal instants in different zones share a key
+		return compositeKey{tag: timeTag{}, elems: v.t.UnixNano()}, true
+	case *BigInt:
+		return compositeKey{tag: bigIntTag{}, elems: v.n.String()}, true
+	case *Set:
+		// sets compare by their elements but may change, so they can't be
+		// keys
+		return nil, false
+	case float64:
+		// floats beyond 2^53 are integers and share a key with the BigInt
+		// equal to them
+		if math.Abs(v) > maxExactInt && !math.IsInf(v, 0) {
+			n, _ := exactInt(v)
+			return compositeKey{tag: bigIntTag{}, elems: n.String()}, true
+		}
+	}
+	return v, v == nil || reflect.TypeOf(v).Comparable()
+}
+
+// Range is the lazy sequence start, start+1, ... up to end, which is
+// excluded unless inclusive is set. It never materializes its elements.
+type Range struct {
+	start     float64
+	end       float64
+	inclusive bool
+}
+
+func (r Range) String() string {
+	if r.inclusive {
+		return fmt.Sprintf("%v..=%v", r.start, r.end)
+	}
+	return fmt.Sprintf("%v..%v", r.start, r.end)
+}
+
+func (r Range) len() int {
+	n, _ := r.count()
+	return n
+}
+
+// count returns the number of elements, ok is false when it doesn't fit in
+// an int. evaluateRangeExpr rejects such ranges so len can't overflow.
+func (r Range) count() (n int, ok bool) {
+	f := r.end - r.start
+	if r.inclusive {
+		f = math.Floor(f) + 1
+	} else {
+		f = math.Ceil(f)
+	}
+	if math.IsNaN(f) || f >= math.MaxInt64 {
+		return 0, false
+	}
+	if f < 0 {
+		return 0, true
+	}
+	return int(f), true
+}
+
+func (r Range) iterator() iterator {
+	return indexIterator(r.len(), func(idx int) interface{} {
+		return r.start + float64(idx)
+	})
+}
+
+// iterable is implemented by values a for-in loop can walk.
+type iterable interface {
+	iterator() iterator
+}
+
+type iterator interface {
+	next() (interface{}, bool)
+}
+
+type iteratorFunc func() (interface{}, bool)
+
+func (f iteratorFunc) next() (interface{}, bool) {
+	return f()
+}
+
+// iterate returns an iterator over v, strings yield one string per code
+// point.
+func iterate(v interface{}, t Token) iterator {
+	switch v := v.(type) {
+	case string:
+		runes := []rune(v)
+		return indexIterator(len(runes), func(idx int) interface{} {
+			return string(runes[idx])
+		})
+	case iterable:
+		return v.iterator()
+	}
+	panic(NewRuntimeErr(t, "value %s is not iterable", repr(v)))
+}
+
+// iterateNames returns the iterator a loop declaring names walks: with two
+// names a map yields its key value pairs.
+func iterateNames(v interface{}, names []Token) iterator {
+	if m, ok := v.(*Map); ok && len(names) == 2 {
+		return m.pairs()
+	}
+	return iterate(v, names[0])
+}
+
+// bindNames defines the loop variables for one element, unpacking it when
+// there is more than one name.
+func bindNames(env *Env, names []Token, value interface{}) {
+	if len(names) == 1 {
+		env.define(names[0].lexeme, value)
+		return
+	}
+
+	var elems []interface{}
+	switch v := value.(type) {
+	case *List:
+		elems = v.elems
+	case *Tuple:
+		elems = v.elems
+	}
+	if len(elems) != len(names) {
+		panic(NewRuntimeErr(names[0], "can't unpack %s into %d variables", repr(value), len(names)))
+	}
+	for idx, name := range names {
+		env.define(name.lexeme, elems[idx])
+	}
+}
+
+// indexIterator yields get(0) ... get(n-1).
+func indexIterator(n int, get func(int) interface{}) iterator {
+	idx := 0
+	return iteratorFunc(func() (interface{}, bool) {
+		if idx >= n {
+			return nil, false
+		}
+		idx += 1
+		return get(idx - 1), true
+	})
+}
+
+// toIndex converts v to an index into a sequence of the given length,
+// counting negative indexes from the end.
+func toIndex(v interface{}, length int, t Token) int {
+	n := toInt(v, t)
+	if n < 0 {
+		n += length
+	}
+	if n < 0 || n >= length {
+		panic(NewRuntimeErr(t, "index %s out of range", repr(v)))
+	}
+	return n
+}
+
+func toInt(v interface{}, t Token) int {
+	f, ok := v.(float64)
+	if !ok || f != math.Trunc(f) {
+		panic(NewRuntimeErr(t, "index must be an integer, got %s", repr(v)))
+	}
+	if f < math.MinInt64 || f >= math.MaxInt64 {
+		panic(NewRuntimeErr(t, "index %s out of range", repr(v)))
+	}
+	return int(f)
+}
+
+// sliceBounds resolves optional slice bounds against a sequence of the
+// given length the way Python does, returning the first index, the
+// exclusive stop and the step.
+func sliceBounds(length int, start, end, step interface{}, t Token) (int, int, int) {
+	s := 1
+	if step != nil {
+		s = toInt(step, t)
+		if s == 0 {
+			panic(NewRuntimeErr(t, "slice step cannot be zero"))
+		}
+	}
+
+	lower, upper := 0, length
+	if s < 0 {
+		lower, upper = -1, length-1
+	}
+	bound := func(v interface{}, def int) int {
+		if v == nil {
+			return def
+		}
+		n := toInt(v, t)
+		if n < 0 {
+			n += length
+			if n < lower {
+				n = lower
+			}
+		} else if n > upper {
+			n = upper
+		}
+		return n
+	}
+
+	if s > 0 {
+		return bound(start, lower), bound(end, upper), s
+	}
+	return bound(start, upper), bound(end, lower), s
+}
+
+// sliceIndexes lists the indexes selected by sliceBounds.
+func sliceIndexes(length int, start, end, step interface{}, t Token) []int {
+	from, to, s := sliceBounds(length, start, end, step, t)
+	var idxs []int
+	for idx := from; (s > 0 && idx < to) || (s < 0 && idx > to); idx += s {
+		idxs = append(idxs, idx)
+	}
+	return idxs
+}
+
+// repr formats a value as it appears inside a container, quoting strings.
+func repr(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return strconv.Quote(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// typeName is the name type() reports for v.
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "bool"
+	case float64, *BigInt:
+		return "number"
+	case string:
+		return "string"
+	case *List:
+		return "list"
+	case *Map:
+		return "map"
+	case Range:
+		return "range"
+	case *Tuple:
+		return "tuple"
+	case *Record:
+		return "record"
+	case *Set:
+		return "set"
+	case *Result:
+		return "result"
+	case *Maybe:
+		return "option"
+	case *Module:
+		return "module"
+	case *DateTime:
+		return "time"
+	case *File:
+		return "file"
+	case Callalble:
+		return "function"
+	case *Coroutine:
+		return "coroutine"
+	case *Task:
+		return "task"
+	case *Channel:
+		return "channel"
+	case *Promise:
+		return "promise"
+	}
+	return fmt.Sprintf("%T", v)
+}